@@ -0,0 +1,43 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/networkteam/refresh/refresh"
+)
+
+var caPath bool
+
+func init() {
+	caCmd.Flags().BoolVar(&caPath, "path", false, "print the path of the certificate file instead of its content")
+	RootCmd.AddCommand(caCmd)
+}
+
+var caCmd = &cobra.Command{
+	Use:   "ca",
+	Short: "prints the development CA certificate of the live reload server for trusting it in your browser or OS.",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// Do not report errors as wrong usage
+		cmd.SilenceUsage = true
+
+		pem, err := refresh.DevCA()
+		if err != nil {
+			return err
+		}
+
+		if caPath {
+			path, err := refresh.DevCAPath()
+			if err != nil {
+				return err
+			}
+			fmt.Println(path)
+			return nil
+		}
+
+		_, err = os.Stdout.Write(pem)
+		return err
+	},
+}
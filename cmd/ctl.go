@@ -0,0 +1,199 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/networkteam/refresh/refresh"
+)
+
+// ctlTimeout is the maximum time to wait for a response of the control API, except for following logs
+const ctlTimeout = 10 * time.Second
+
+var (
+	ctlService    string
+	ctlJSON       bool
+	ctlLogsLines  int
+	ctlLogsFollow bool
+)
+
+func init() {
+	ctlCmd.PersistentFlags().StringVarP(&ctlService, "service", "s", "", "only apply the action to the named service")
+	ctlStatusCmd.Flags().BoolVar(&ctlJSON, "json", false, "print the status as JSON")
+	ctlLogsCmd.Flags().IntVarP(&ctlLogsLines, "lines", "n", 0, "number of lines to print (default all)")
+	ctlLogsCmd.Flags().BoolVarP(&ctlLogsFollow, "follow", "f", false, "print new lines until interrupted")
+
+	ctlCmd.AddCommand(ctlStatusCmd, ctlLogsCmd)
+	for _, action := range []struct{ name, short string }{
+		{"rebuild", "builds and restarts the app."},
+		{"restart", "restarts the app without a build."},
+		{"rollback", "restarts the app on the previous build (requires build_history)."},
+		{"pause", "stops reacting to changes."},
+		{"resume", "reacts to changes again."},
+		{"stop", "stops the app and refresh."},
+	} {
+		ctlCmd.AddCommand(ctlActionCmd(action.name, action.short))
+	}
+	RootCmd.AddCommand(ctlCmd)
+}
+
+var ctlCmd = &cobra.Command{
+	Use:   "ctl",
+	Short: "controls the refresh running in the current directory (requires the control API).",
+}
+
+var ctlStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "prints the state of the app, exits with an error if it is not running.",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// Do not report errors as wrong usage
+		cmd.SilenceUsage = true
+
+		c, err := refresh.NewControlClient()
+		if err != nil {
+			return err
+		}
+		ctx, cancel := context.WithTimeout(cmd.Context(), ctlTimeout)
+		defer cancel()
+		status, err := c.Status(ctx)
+		if err != nil {
+			return err
+		}
+
+		if ctlJSON {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			err = enc.Encode(status)
+			if err != nil {
+				return err
+			}
+		} else {
+			printStatus(status)
+		}
+
+		found := false
+		for _, s := range status.Services {
+			if ctlService != "" && s.Service != ctlService {
+				continue
+			}
+			found = true
+			if s.State != refresh.StateRunning && s.Service != "" {
+				return fmt.Errorf("service %s is %s", s.Service, s.State)
+			}
+			if s.State != refresh.StateRunning {
+				return fmt.Errorf("app is %s", s.State)
+			}
+		}
+		if !found {
+			return fmt.Errorf("unknown service %q", ctlService)
+		}
+		return nil
+	},
+}
+
+func ctlActionCmd(action, short string) *cobra.Command {
+	return &cobra.Command{
+		Use:   action,
+		Short: short,
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			// Do not report errors as wrong usage
+			cmd.SilenceUsage = true
+
+			c, err := refresh.NewControlClient()
+			if err != nil {
+				return err
+			}
+			ctx, cancel := context.WithTimeout(cmd.Context(), ctlTimeout)
+			defer cancel()
+			_, err = c.Action(ctx, action, ctlService)
+			return err
+		},
+	}
+}
+
+var ctlLogsCmd = &cobra.Command{
+	Use:   "logs",
+	Short: "prints the output of the app.",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// Do not report errors as wrong usage
+		cmd.SilenceUsage = true
+
+		c, err := refresh.NewControlClient()
+		if err != nil {
+			return err
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+		defer stop()
+		if !ctlLogsFollow {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, ctlTimeout)
+			defer cancel()
+		}
+		return c.Logs(ctx, os.Stdout, ctlLogsLines, ctlLogsFollow)
+	},
+}
+
+func printStatus(status refresh.ControlStatus) {
+	for _, s := range status.Services {
+		if ctlService != "" && s.Service != ctlService {
+			continue
+		}
+
+		var line strings.Builder
+		if s.Service != "" {
+			line.WriteString(s.Service + ": ")
+		}
+		line.WriteString(s.State)
+		switch {
+		case s.Paused && s.PausedChanges == 1:
+			line.WriteString(" (paused, 1 change)")
+		case s.Paused && s.PausedChanges > 1:
+			fmt.Fprintf(&line, " (paused, %d changes)", s.PausedChanges)
+		case s.Paused:
+			line.WriteString(" (paused)")
+		case s.GitOperation != "":
+			fmt.Fprintf(&line, " (holding builds during git operation %s)", s.GitOperation)
+		}
+
+		if b := s.LastBuild; b != nil {
+			result := "ok"
+			if !b.Success {
+				result = "failed"
+				if n := len(b.Diagnostics); n == 1 {
+					result += " with 1 error"
+				} else if n > 1 {
+					result += fmt.Sprintf(" with %d errors", n)
+				}
+			}
+			fmt.Fprintf(&line, ", last build %s in %s (%s ago)", result, b.Duration.Round(time.Millisecond), time.Since(b.Time).Round(time.Second))
+		}
+		fmt.Println(line.String())
+
+		for _, p := range s.Processes {
+			name := p.Name
+			if name == "" {
+				name = "process"
+			}
+			switch {
+			case p.Running:
+				fmt.Printf("  %s: running (pid %d)\n", name, p.PID)
+			case p.Crashed:
+				fmt.Printf("  %s: crashed\n", name)
+			default:
+				fmt.Printf("  %s: stopped\n", name)
+			}
+		}
+	}
+}
@@ -33,6 +33,7 @@ var initCmd = &cobra.Command{
 			CommandFlags:       []string{},
 			CommandEnv:         []string{},
 			EnableColors:       true,
+			GitPause:           true,
 		}
 
 		if cfgFile == "" {
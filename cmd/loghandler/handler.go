@@ -9,6 +9,8 @@ import (
 	"github.com/apex/log"
 	"github.com/fatih/color"
 	colorable "github.com/mattn/go-colorable"
+
+	"github.com/networkteam/refresh/refresh"
 )
 
 // Based on github.com/apex/log/handlers/cli
@@ -69,7 +71,7 @@ func (h *Handler) HandleLog(e *log.Entry) error {
 	color.Fprintf(h.Writer, "%s %-40s", level, e.Message)
 
 	for _, name := range names {
-		if name == "source" {
+		if name == "source" || name == refresh.LifecycleField || name == refresh.DiagnosticsField {
 			continue
 		}
 		fmt.Fprintf(h.Writer, " %s=%v", color.Sprint(name), e.Fields.Get(name))
@@ -0,0 +1,79 @@
+package loghandler
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/apex/log"
+
+	"github.com/networkteam/refresh/refresh"
+)
+
+// JSONHandler writes one JSON object per log entry and line.
+// The lifecycle field of refresh is written as event, all other fields as fields.
+type JSONHandler struct {
+	mu     sync.Mutex
+	Writer io.Writer
+}
+
+// NewJSON handler.
+func NewJSON(w io.Writer) *JSONHandler {
+	return &JSONHandler{
+		Writer: w,
+	}
+}
+
+type jsonEntry struct {
+	Time    time.Time              `json:"time"`
+	Level   string                 `json:"level"`
+	Message string                 `json:"message"`
+	Event   string                 `json:"event,omitempty"`
+	Fields  map[string]interface{} `json:"fields,omitempty"`
+}
+
+// HandleLog implements log.Handler.
+func (h *JSONHandler) HandleLog(e *log.Entry) error {
+	entry := jsonEntry{
+		Time:    e.Timestamp,
+		Level:   e.Level.String(),
+		Message: e.Message,
+	}
+	for name, value := range e.Fields {
+		if name == refresh.LifecycleField {
+			entry.Event, _ = value.(string)
+			continue
+		}
+		if entry.Fields == nil {
+			entry.Fields = make(map[string]interface{}, len(e.Fields))
+		}
+		// Errors and durations are written as text instead of an empty object or nanoseconds,
+		// values with their own JSON encoding (e.g. times) are kept
+		switch v := value.(type) {
+		case error:
+			value = v.Error()
+		case json.Marshaler:
+		case fmt.Stringer:
+			value = v.String()
+		}
+		entry.Fields[name] = value
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		// Keep the entry without the fields that could not be encoded
+		entry.Fields = map[string]interface{}{"log_error": err.Error()}
+		data, err = json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	_, err = h.Writer.Write(append(data, '\n'))
+	return err
+}
@@ -0,0 +1,117 @@
+package loghandler
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/apex/log"
+
+	"github.com/networkteam/refresh/refresh"
+)
+
+func TestJSONHandler_HandleLog(t *testing.T) {
+	var buf bytes.Buffer
+	l := &log.Logger{Handler: NewJSON(&buf), Level: log.InfoLevel}
+
+	l.WithField(refresh.LifecycleField, refresh.LifecycleBuildOK).
+		WithField("duration", 1500*time.Millisecond).
+		Info("Build complete")
+	l.WithField(refresh.LifecycleField, refresh.LifecycleBuildFailed).
+		WithField(refresh.DiagnosticsField, []refresh.Diagnostic{{File: "main.go", Line: 9, Column: 14, Message: "undefined: x"}}).
+		Error("Build failed")
+	l.WithError(errors.New("exit status 1")).
+		WithField("exit_code", 1).
+		Error("exit status 1")
+
+	var entries []map[string]interface{}
+	dec := json.NewDecoder(&buf)
+	for dec.More() {
+		var entry map[string]interface{}
+		if err := dec.Decode(&entry); err != nil {
+			t.Fatal(err)
+		}
+		entries = append(entries, entry)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("got %d entries, want 3", len(entries))
+	}
+
+	build := entries[0]
+	if build["event"] != refresh.LifecycleBuildOK {
+		t.Errorf("event = %v, want %q", build["event"], refresh.LifecycleBuildOK)
+	}
+	if build["level"] != "info" || build["message"] != "Build complete" {
+		t.Errorf("level = %v, message = %v", build["level"], build["message"])
+	}
+	fields, _ := build["fields"].(map[string]interface{})
+	if fields["duration"] != "1.5s" {
+		t.Errorf("duration = %v, want 1.5s", fields["duration"])
+	}
+	if _, ok := fields[refresh.LifecycleField]; ok {
+		t.Error("lifecycle field should only be written as event")
+	}
+
+	failed := entries[1]
+	fields, _ = failed["fields"].(map[string]interface{})
+	diagnostics, _ := fields[refresh.DiagnosticsField].([]interface{})
+	if len(diagnostics) != 1 {
+		t.Fatalf("diagnostics = %v, want one diagnostic", fields[refresh.DiagnosticsField])
+	}
+	if d, _ := diagnostics[0].(map[string]interface{}); d["file"] != "main.go" || d["line"] != float64(9) {
+		t.Errorf("diagnostic = %v, want main.go:9", d)
+	}
+
+	exit := entries[2]
+	if _, ok := exit["event"]; ok {
+		t.Errorf("entry without lifecycle field has event %v", exit["event"])
+	}
+	fields, _ = exit["fields"].(map[string]interface{})
+	if fields["error"] != "exit status 1" || fields["exit_code"] != float64(1) {
+		t.Errorf("fields = %v", fields)
+	}
+	if _, err := time.Parse(time.RFC3339Nano, exit["time"].(string)); err != nil {
+		t.Errorf("time: %v", err)
+	}
+}
+
+func TestJSONHandler_HandleLog_fieldEncoding(t *testing.T) {
+	var buf bytes.Buffer
+	l := &log.Logger{Handler: NewJSON(&buf), Level: log.InfoLevel}
+
+	started := time.Date(2026, 10, 19, 12, 30, 0, 0, time.UTC)
+	l.WithField("started", started).Info("Started")
+	// Values that can't be encoded must not drop the entry
+	l.WithField(refresh.LifecycleField, refresh.LifecycleProcessExit).
+		WithField("callback", func() {}).
+		Info("Exited")
+
+	var entries []map[string]interface{}
+	dec := json.NewDecoder(&buf)
+	for dec.More() {
+		var entry map[string]interface{}
+		if err := dec.Decode(&entry); err != nil {
+			t.Fatal(err)
+		}
+		entries = append(entries, entry)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("got %d entries, want 2", len(entries))
+	}
+
+	fields, _ := entries[0]["fields"].(map[string]interface{})
+	if fields["started"] != "2026-10-19T12:30:00Z" {
+		t.Errorf("started = %v, want the time as RFC 3339", fields["started"])
+	}
+
+	exited := entries[1]
+	if exited["message"] != "Exited" || exited["event"] != refresh.LifecycleProcessExit {
+		t.Errorf("message = %v, event = %v", exited["message"], exited["event"])
+	}
+	fields, _ = exited["fields"].(map[string]interface{})
+	if fields["log_error"] == nil {
+		t.Errorf("fields = %v, want the encoding error", fields)
+	}
+}
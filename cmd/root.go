@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"fmt"
 	"os"
 	dbg "runtime/debug"
 
@@ -13,20 +14,29 @@ import (
 var cfgFile string
 var debug bool
 var verbosity int
+var logFormat string
 
 var RootCmd = &cobra.Command{
 	Use:   "refresh",
 	Short: "Refresh is a command line tool that builds and (re)starts your Go application everytime you save a Go or template file.",
-	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
 		log.SetLevel(logLevel(verbosity))
-		h := loghandler.New(os.Stderr)
-		h.Prefix = "⎯⎯⎯⎯⎯⎯ ⚡️refresh ⎯⎯⎯⎯⎯ "
-		log.SetHandler(h)
+		switch logFormat {
+		case "text":
+			h := loghandler.New(os.Stderr)
+			h.Prefix = "⎯⎯⎯⎯⎯⎯ ⚡️refresh ⎯⎯⎯⎯⎯ "
+			log.SetHandler(h)
+		case "json":
+			log.SetHandler(loghandler.NewJSON(os.Stderr))
+		default:
+			return fmt.Errorf("invalid log format %q, must be text or json", logFormat)
+		}
 
 		buildInfo, ok := dbg.ReadBuildInfo()
 		if ok {
 			log.Debugf("Version %s", buildInfo.Main.Version)
 		}
+		return nil
 	},
 	RunE: func(cmd *cobra.Command, args []string) error {
 		return Run(cfgFile)
@@ -43,4 +53,5 @@ func init() {
 	RootCmd.PersistentFlags().BoolVarP(&debug, "debug", "d", false, "use delve to debug the app")
 	RootCmd.PersistentFlags().StringVarP(&cfgFile, "config", "c", "", "path to configuration file")
 	RootCmd.PersistentFlags().IntVarP(&verbosity, "verbosity", "v", 3, "verbosity of log output: 0=fatal, 1=error, 2=warn, 3=info, 4=debug")
+	RootCmd.PersistentFlags().StringVar(&logFormat, "log-format", "text", "format of log output: text or json")
 }
@@ -24,8 +24,8 @@ var runCmd = &cobra.Command{
 	Use:     "run",
 	Aliases: []string{"r", "start", "build", "watch"},
 	Short:   "(default) watches your files and rebuilds/restarts your app accordingly.",
-	Run: func(cmd *cobra.Command, args []string) {
-		Run(cfgFile)
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return Run(cfgFile)
 	},
 }
 
@@ -53,6 +53,16 @@ func RunWithContext(cfgFile string, ctx context.Context) error {
 	if debug {
 		c.Debug = true
 	}
+	// Text output would be mixed into the JSON log entries on stderr
+	c.JSONLogs = logFormat == "json"
+
+	if len(c.Services) > 0 {
+		s, err := refresh.NewSupervisorWithContext(c, ctx)
+		if err != nil {
+			return err
+		}
+		return s.Start()
+	}
 
 	r := refresh.NewWithContext(c, ctx)
 	return r.Start()
@@ -10,6 +10,9 @@ require (
 	github.com/rjeczalik/notify v0.9.3
 	github.com/rs/cors v1.10.1
 	github.com/spf13/cobra v1.7.0
+	golang.org/x/mod v0.12.0
+	golang.org/x/net v0.35.0
+	golang.org/x/sys v0.30.0
 	gopkg.in/cenkalti/backoff.v1 v1.1.0
 	gopkg.in/yaml.v2 v2.4.0
 )
@@ -19,6 +22,4 @@ require (
 	github.com/mattn/go-isatty v0.0.19 // indirect
 	github.com/pkg/errors v0.9.1 // indirect
 	github.com/spf13/pflag v1.0.5 // indirect
-	golang.org/x/net v0.0.0-20191116160921-f9c825593386 // indirect
-	golang.org/x/sys v0.10.0 // indirect
 )
@@ -0,0 +1,218 @@
+// Package livereload injects the live reload script of refresh into HTML responses.
+//
+//	http.ListenAndServe(":3000", livereload.Middleware(mux))
+//
+// The middleware only has an effect if the app is run by refresh with live_reload enabled,
+// otherwise (e.g. in production) the handler is returned unchanged.
+package livereload
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"html"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// ScriptURLEnv is the environment variable refresh passes the URL of the live reload script in
+const ScriptURLEnv = "REFRESH_LIVE_RELOAD_SCRIPT_URL"
+
+// ScriptURL returns the URL of the live reload script or an empty string if live reload is not enabled
+func ScriptURL() string {
+	return os.Getenv(ScriptURLEnv)
+}
+
+// Middleware injects the live reload script before the closing body tag of HTML responses.
+// Responses without a closing body tag (e.g. HTML fragments for htmx) are not changed.
+// Gzip compressed responses are decompressed and compressed again, other encodings (e.g. br or deflate) are not changed.
+func Middleware(next http.Handler) http.Handler {
+	scriptURL := ScriptURL()
+	if scriptURL == "" {
+		return next
+	}
+
+	script := []byte(fmt.Sprintf(`<script src="%s"></script>`, html.EscapeString(scriptURL)))
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		iw := &injectWriter{
+			ResponseWriter: w,
+			script:         script,
+			head:           r.Method == http.MethodHead,
+		}
+		defer iw.finish()
+		next.ServeHTTP(iw, r)
+	})
+}
+
+// injectWriter buffers HTML responses for injecting the script, other responses are passed through
+type injectWriter struct {
+	http.ResponseWriter
+	script []byte
+	head   bool
+
+	status      int
+	decided     bool
+	inject      bool
+	wroteHeader bool
+	buf         bytes.Buffer
+}
+
+func (w *injectWriter) WriteHeader(code int) {
+	if w.status != 0 {
+		return
+	}
+	w.status = code
+}
+
+func (w *injectWriter) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	if !w.decided {
+		if p == nil {
+			p = []byte{}
+		}
+		w.decide(p)
+	}
+	if w.inject {
+		return w.buf.Write(p)
+	}
+	w.writeHeader()
+	return w.ResponseWriter.Write(p)
+}
+
+// decide checks if the script is injected into the response by the status, content type and encoding.
+// The body is nil if the response is flushed before it is written, then only the headers are checked.
+func (w *injectWriter) decide(body []byte) {
+	w.decided = true
+
+	if w.head || w.status < 200 || w.status == http.StatusNoContent || w.status == http.StatusNotModified {
+		return
+	}
+
+	h := w.Header()
+	encoding := strings.ToLower(h.Get("Content-Encoding"))
+	switch encoding {
+	case "", "identity", "gzip":
+	default:
+		// Other encodings (e.g. br or deflate) can't be rewritten, the response is passed through untouched
+		return
+	}
+
+	contentType := h.Get("Content-Type")
+	if contentType == "" {
+		// The content type can't be detected from compressed or missing bytes
+		if (encoding != "" && encoding != "identity") || body == nil {
+			return
+		}
+		contentType = http.DetectContentType(body)
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return
+	}
+	w.inject = mediaType == "text/html"
+}
+
+func (w *injectWriter) writeHeader() {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	w.ResponseWriter.WriteHeader(w.status)
+}
+
+// finish writes the buffered response with the injected script
+func (w *injectWriter) finish() {
+	if !w.inject {
+		if w.status != 0 {
+			w.writeHeader()
+		}
+		return
+	}
+
+	body := w.buf.Bytes()
+	if injected, ok := w.injectScript(body); ok {
+		body = injected
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	}
+	w.writeHeader()
+	_, _ = w.ResponseWriter.Write(body)
+}
+
+func (w *injectWriter) injectScript(body []byte) ([]byte, bool) {
+	gzipped := strings.EqualFold(w.Header().Get("Content-Encoding"), "gzip")
+	if gzipped {
+		r, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			return nil, false
+		}
+		body, err = io.ReadAll(r)
+		if err != nil {
+			return nil, false
+		}
+	}
+
+	i := bytes.LastIndex(bytes.ToLower(body), []byte("</body>"))
+	if i == -1 {
+		return nil, false
+	}
+	injected := make([]byte, 0, len(body)+len(w.script))
+	injected = append(injected, body[:i]...)
+	injected = append(injected, w.script...)
+	injected = append(injected, body[i:]...)
+
+	if gzipped {
+		var buf bytes.Buffer
+		gw := gzip.NewWriter(&buf)
+		_, _ = gw.Write(injected)
+		_ = gw.Close()
+		injected = buf.Bytes()
+	}
+	return injected, true
+}
+
+// Flush passes through flushes of responses that are not buffered. Streaming responses (e.g. SSE) flush
+// before the first write, then it is decided by the headers if the response is buffered.
+func (w *injectWriter) Flush() {
+	if !w.decided {
+		if w.status == 0 {
+			w.status = http.StatusOK
+		}
+		w.decide(nil)
+	}
+	if w.inject {
+		return
+	}
+	w.writeHeader()
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack passes through hijacking of the connection (e.g. for WebSockets), the response is not changed
+func (w *injectWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hj, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("response writer %T does not support hijacking", w.ResponseWriter)
+	}
+	w.decided = true
+	w.inject = false
+	w.wroteHeader = true
+	return hj.Hijack()
+}
+
+// Unwrap returns the original response writer for http.ResponseController
+func (w *injectWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
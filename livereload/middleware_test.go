@@ -0,0 +1,216 @@
+package livereload
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+const testScriptURL = "http://127.0.0.1:35729/static/reload.js"
+
+func TestMiddleware(t *testing.T) {
+	script := `<script src="` + testScriptURL + `"></script>`
+
+	tests := []struct {
+		name        string
+		contentType string
+		encoding    string
+		body        string
+		want        string
+	}{
+		{
+			name:        "html",
+			contentType: "text/html; charset=utf-8",
+			body:        "<html><body><h1>Hello</h1></body></html>",
+			want:        "<html><body><h1>Hello</h1>" + script + "</body></html>",
+		},
+		{
+			name: "sniffed html",
+			body: "<!DOCTYPE html><html><body></BODY></html>",
+			want: "<!DOCTYPE html><html><body>" + script + "</BODY></html>",
+		},
+		{
+			name:        "gzip html",
+			contentType: "text/html",
+			encoding:    "gzip",
+			body:        "<html><body></body></html>",
+			want:        "<html><body>" + script + "</body></html>",
+		},
+		{
+			name:        "html fragment",
+			contentType: "text/html",
+			body:        "<li>Item</li>",
+			want:        "<li>Item</li>",
+		},
+		{
+			name:        "json",
+			contentType: "application/json",
+			body:        `{"html":"</body>"}`,
+			want:        `{"html":"</body>"}`,
+		},
+		{
+			name:        "brotli is passed through",
+			contentType: "text/html",
+			encoding:    "br",
+			body:        "<html><body></body></html>",
+			want:        "<html><body></body></html>",
+		},
+		{
+			name:        "deflate is passed through",
+			contentType: "text/html",
+			encoding:    "deflate",
+			body:        "<html><body></body></html>",
+			want:        "<html><body></body></html>",
+		},
+		{
+			name:     "compressed without content type is passed through",
+			encoding: "deflate",
+			body:     "<html><body></body></html>",
+			want:     "<html><body></body></html>",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(ScriptURLEnv, testScriptURL)
+
+			h := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tt.contentType != "" {
+					w.Header().Set("Content-Type", tt.contentType)
+				}
+				body := []byte(tt.body)
+				if tt.encoding != "" {
+					w.Header().Set("Content-Encoding", tt.encoding)
+				}
+				if tt.encoding == "gzip" {
+					body = gzipped(t, body)
+				}
+				// Write in two parts, so the response is buffered
+				_, _ = w.Write(body[:len(body)/2])
+				_, _ = w.Write(body[len(body)/2:])
+			}))
+
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+			body := rec.Body.Bytes()
+			if tt.encoding == "gzip" {
+				r, err := gzip.NewReader(bytes.NewReader(body))
+				if err != nil {
+					t.Fatal(err)
+				}
+				body, err = io.ReadAll(r)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			if got := string(body); got != tt.want {
+				t.Errorf("body = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMiddleware_flushBeforeWrite(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		encoding    string
+		wantFlushed bool
+	}{
+		{name: "event stream", contentType: "text/event-stream", wantFlushed: true},
+		{name: "without content type", wantFlushed: true},
+		{name: "compressed html", contentType: "text/html", encoding: "br", wantFlushed: true},
+		{name: "html is buffered for injecting", contentType: "text/html", wantFlushed: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(ScriptURLEnv, testScriptURL)
+
+			rec := httptest.NewRecorder()
+			h := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tt.contentType != "" {
+					w.Header().Set("Content-Type", tt.contentType)
+				}
+				if tt.encoding != "" {
+					w.Header().Set("Content-Encoding", tt.encoding)
+				}
+				w.WriteHeader(http.StatusOK)
+				w.(http.Flusher).Flush()
+
+				// The headers must be sent before anything is written
+				if rec.Flushed != tt.wantFlushed {
+					t.Errorf("flushed = %v, want %v", rec.Flushed, tt.wantFlushed)
+				}
+				_, _ = w.Write([]byte("data: ok\n\n"))
+			}))
+			h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+			if rec.Code != http.StatusOK || rec.Body.String() != "data: ok\n\n" {
+				t.Errorf("response = %d %q", rec.Code, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestMiddleware_disabled(t *testing.T) {
+	t.Setenv(ScriptURLEnv, "")
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	h := Middleware(next)
+
+	if _, ok := h.(http.HandlerFunc); !ok {
+		t.Fatalf("Middleware() = %T, want the next handler", h)
+	}
+}
+
+func TestMiddleware_hijack(t *testing.T) {
+	t.Setenv(ScriptURLEnv, testScriptURL)
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, buf, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+		_, _ = buf.WriteString("HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: test\r\n\r\n")
+		_ = buf.Flush()
+	})
+	srv := httptest.NewServer(Middleware(next))
+	defer srv.Close()
+
+	req, err := http.NewRequest(http.MethodGet, srv.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "test")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Errorf("status = %d, want %d", resp.StatusCode, http.StatusSwitchingProtocols)
+	}
+}
+
+func gzipped(t *testing.T, b []byte) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(b); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
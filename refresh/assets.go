@@ -0,0 +1,96 @@
+package refresh
+
+import (
+	"encoding/hex"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/apex/log"
+)
+
+// liveReloadAssetsPath is the URL path of the static asset directories on the live reload server
+const liveReloadAssetsPath = "/assets/"
+
+// assetDirs returns the absolute static asset directories that are served by the live reload server
+func (c *Configuration) assetDirs() []string {
+	if !c.LiveReload {
+		return nil
+	}
+
+	dirs := make([]string, 0, len(c.LiveReloadAssets))
+	for _, dir := range c.LiveReloadAssets {
+		if !filepath.IsAbs(dir) {
+			dir = filepath.Join(c.AppRoot, dir)
+		}
+		abs, err := filepath.Abs(dir)
+		if err != nil {
+			log.WithError(err).Warnf("liveReload: Invalid asset directory %s", dir)
+			continue
+		}
+		dirs = append(dirs, abs)
+	}
+	return dirs
+}
+
+// assetRoots returns watch roots for the static asset directories, so changes are sent to live reload clients without a build
+func (c *Configuration) assetRoots() []WatchRoot {
+	dirs := c.assetDirs()
+	roots := make([]WatchRoot, 0, len(dirs))
+	for _, dir := range dirs {
+		roots = append(roots, WatchRoot{
+			Path:      dir,
+			Recursive: true,
+			Action:    ActionReload,
+		})
+	}
+	return roots
+}
+
+// assetHandler serves files from the first directory that contains them. Files are always revalidated
+// by clients (no-cache) and get an ETag from their content, so unchanged files are not transferred again.
+type assetHandler struct {
+	dirs []string
+}
+
+func (h assetHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Separators other than a slash could be used to escape the directories (like http.Dir)
+	if filepath.Separator != '/' && strings.ContainsRune(r.URL.Path, filepath.Separator) {
+		http.NotFound(w, r)
+		return
+	}
+	// Cleaning the rooted path removes any ".." elements
+	name := filepath.FromSlash(path.Clean("/" + r.URL.Path))
+
+	for _, dir := range h.dirs {
+		file := filepath.Join(dir, name)
+		f, err := os.Open(file)
+		if err != nil {
+			continue
+		}
+		fi, err := f.Stat()
+		if err != nil || fi.IsDir() {
+			f.Close()
+			continue
+		}
+
+		hash, err := hashFile(file)
+		if err == nil {
+			w.Header().Set("ETag", `"`+hex.EncodeToString(hash[:])+`"`)
+		}
+		w.Header().Set("Cache-Control", "no-cache")
+
+		http.ServeContent(w, r, fi.Name(), fi.ModTime(), f)
+		f.Close()
+		return
+	}
+
+	http.NotFound(w, r)
+}
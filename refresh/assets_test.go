@@ -0,0 +1,98 @@
+package refresh
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAssetHandler(t *testing.T) {
+	public := t.TempDir()
+	vendor := t.TempDir()
+	if err := os.WriteFile(filepath.Join(public, "main.css"), []byte("body { color: red; }"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(vendor, "main.css"), []byte("body { color: blue; }"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(vendor, "lib.css"), []byte("p { margin: 0; }"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(filepath.Dir(public), "secret.txt"), []byte("secret"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	h := assetHandler{dirs: []string{public, vendor}}
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		wantStatus int
+		wantBody   string
+	}{
+		{name: "file of first directory", path: "/main.css", wantStatus: http.StatusOK, wantBody: "body { color: red; }"},
+		{name: "file of second directory", path: "/lib.css", wantStatus: http.StatusOK, wantBody: "p { margin: 0; }"},
+		{name: "missing file", path: "/missing.css", wantStatus: http.StatusNotFound},
+		{name: "directory", path: "/", wantStatus: http.StatusNotFound},
+		{name: "parent directory", path: "/../secret.txt", wantStatus: http.StatusNotFound},
+		{name: "post", method: http.MethodPost, path: "/main.css", wantStatus: http.StatusMethodNotAllowed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			method := tt.method
+			if method == "" {
+				method = http.MethodGet
+			}
+			req := httptest.NewRequest(method, "/", nil)
+			req.URL.Path = tt.path
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if tt.wantBody != "" && rec.Body.String() != tt.wantBody {
+				t.Errorf("body = %q, want %q", rec.Body.String(), tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestAssetHandler_etag(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "main.css"), []byte("body { color: red; }"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	h := assetHandler{dirs: []string{dir}}
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/main.css", nil))
+	etag := rec.Header().Get("ETag")
+	if etag == "" {
+		t.Fatal("missing ETag")
+	}
+	if got := rec.Header().Get("Cache-Control"); got != "no-cache" {
+		t.Errorf("Cache-Control = %q, want no-cache", got)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/main.css", nil)
+	req.Header.Set("If-None-Match", etag)
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotModified {
+		t.Errorf("status with matching ETag = %d, want %d", rec.Code, http.StatusNotModified)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "main.css"), []byte("body { color: blue; }"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/main.css", nil))
+	if got := rec.Header().Get("ETag"); got == etag {
+		t.Errorf("ETag unchanged after the file changed")
+	}
+}
@@ -0,0 +1,99 @@
+package refresh
+
+import (
+	"bytes"
+	"crypto/md5"
+	"debug/elf"
+	"debug/macho"
+	"debug/pe"
+	"io"
+	"os"
+)
+
+var goBuildIDMarker = []byte("\xff Go build ID: \"")
+
+// binaryHash hashes an executable without its build IDs. They are derived from the sources and
+// change with every edit, even if the compiled code stays the same (e.g. comment-only changes).
+func binaryHash(path string) ([md5.Size]byte, error) {
+	var hash [md5.Size]byte
+
+	sections, err := executableSections(path)
+	if err != nil {
+		return hash, err
+	}
+
+	h := md5.New()
+	for _, data := range sections {
+		// Mach-O and PE binaries contain the Go build ID at the start of the text section
+		if i := bytes.Index(data, goBuildIDMarker); i >= 0 {
+			start := i + len(goBuildIDMarker)
+			if end := bytes.IndexByte(data[start:], '"'); end >= 0 {
+				data = bytes.ReplaceAll(data, data[start:start+end], nil)
+			}
+		}
+		_, _ = h.Write(data)
+	}
+	copy(hash[:], h.Sum(nil))
+	return hash, nil
+}
+
+// executableSections returns the contents of all sections, except notes that contain build IDs on ELF.
+// The Mach-O UUID is in a load command and not in a section.
+func executableSections(path string) ([][]byte, error) {
+	var sections [][]byte
+
+	if f, err := elf.Open(path); err == nil {
+		defer f.Close()
+		for _, s := range f.Sections {
+			if s.Type == elf.SHT_NOTE || s.Type == elf.SHT_NOBITS {
+				continue
+			}
+			data, err := s.Data()
+			if err != nil {
+				return nil, err
+			}
+			sections = append(sections, data)
+		}
+		return sections, nil
+	}
+
+	if f, err := macho.Open(path); err == nil {
+		defer f.Close()
+		for _, s := range f.Sections {
+			// Skip zero fill sections without data
+			if s.Flags&0xff == 0x1 {
+				continue
+			}
+			data, err := s.Data()
+			if err != nil {
+				return nil, err
+			}
+			sections = append(sections, data)
+		}
+		return sections, nil
+	}
+
+	if f, err := pe.Open(path); err == nil {
+		defer f.Close()
+		for _, s := range f.Sections {
+			data, err := s.Data()
+			if err != nil {
+				return nil, err
+			}
+			sections = append(sections, data)
+		}
+		return sections, nil
+	}
+
+	// Unknown format, use the whole file
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+	return [][]byte{data}, nil
+}
@@ -0,0 +1,103 @@
+package refresh
+
+import (
+	"crypto/md5"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestBinaryHash(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds binaries")
+	}
+
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "go.mod"), "module example.com/app\n\ngo 1.20\n")
+
+	build := func(name, source string) [md5.Size]byte {
+		t.Helper()
+		writeFile(t, filepath.Join(dir, "main.go"), source)
+		out := filepath.Join(dir, name)
+		cmd := exec.Command("go", "build", "-o", out, ".")
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(), "GOFLAGS=", "GOWORK=off")
+		if output, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("go build: %v\n%s", err, output)
+		}
+		hash, err := binaryHash(out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return hash
+	}
+
+	original := build("original", "package main\n\nfunc main() { println(\"ok\") }\n")
+	// The build ID changes with the sources, the compiled code does not (comments shifting lines change the line table)
+	comment := build("comment", "package main\n\nfunc main() { println(\"ok\") } // prints ok\n")
+	changed := build("changed", "package main\n\nfunc main() { println(\"changed\") }\n")
+
+	if comment != original {
+		t.Error("hash changed after a comment-only change")
+	}
+	if changed == original {
+		t.Error("hash did not change after a code change")
+	}
+}
+
+func TestUnchangedBuild(t *testing.T) {
+	hash := [md5.Size]byte{1}
+	other := [md5.Size]byte{2}
+
+	tests := []struct {
+		name    string
+		built   [md5.Size]byte
+		events  []WatchEvent
+		running bool
+		want    bool
+	}{
+		{
+			name:    "identical binary after go change",
+			built:   hash,
+			events:  []WatchEvent{{Path: "/app/main.go"}},
+			running: true,
+			want:    true,
+		},
+		{
+			name:    "changed binary",
+			built:   other,
+			events:  []WatchEvent{{Path: "/app/main.go"}},
+			running: true,
+			want:    false,
+		},
+		{
+			name:    "identical binary after template change",
+			built:   hash,
+			events:  []WatchEvent{{Path: "/app/main.go"}, {Path: "/app/templates/index.html"}},
+			running: true,
+			want:    false,
+		},
+		{
+			name:    "initial build",
+			built:   hash,
+			events:  []WatchEvent{{Path: "/app", Type: "init"}},
+			running: true,
+			want:    false,
+		},
+		{
+			name:   "process is not running",
+			built:  hash,
+			events: []WatchEvent{{Path: "/app/main.go"}},
+			want:   false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := unchangedBuild(hash, tt.built, tt.events, tt.running); got != tt.want {
+				t.Errorf("unchangedBuild() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
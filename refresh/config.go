@@ -16,27 +16,135 @@ import (
 
 type Configuration struct {
 	AppRoot            string        `yaml:"app_root"`
+	AutoPort           bool          `yaml:"auto_port"`
 	BinaryName         string        `yaml:"binary_name"`
+	BuildAffectedOnly  bool          `yaml:"build_affected_only"`
 	BuildDelay         time.Duration `yaml:"build_delay"`
 	BuildFlags         []string      `yaml:"build_flags"`
+	BuildHistory       int           `yaml:"build_history"`
 	BuildPath          string        `yaml:"build_path"`
 	BuildTargetPath    string        `yaml:"build_target_path"`
 	CommandEnv         []string      `yaml:"command_env"`
 	CommandFlags       []string      `yaml:"command_flags"`
+	Control            bool          `yaml:"control"`
+	ControlAddr        string        `yaml:"control_addr"`
+	DeduplicateEvents  bool          `yaml:"deduplicate_events"`
+	EditorURL          string        `yaml:"editor_url"`
 	EnableColors       bool          `yaml:"enable_colors"`
+	GitPause           bool          `yaml:"git_pause"`
+	IgnoredEvents      []string      `yaml:"ignored_events"`
 	IgnoredFolders     []string      `yaml:"ignored_folders"`
 	IncludedExtensions []string      `yaml:"included_extensions"`
 	IncludedPatterns   []string      `yaml:"included_patterns"`
+	KeyboardShortcuts  bool          `yaml:"keyboard_shortcuts"`
 	LiveReload         bool          `yaml:"live_reload"`
+	LiveReloadAddr     string        `yaml:"live_reload_addr"`
+	LiveReloadAssets   []string      `yaml:"live_reload_assets"`
+	LiveReloadOrigins  []string      `yaml:"live_reload_origins"`
+	LiveReloadTLS      bool          `yaml:"live_reload_tls"`
+	LiveReloadTLSCert  string        `yaml:"live_reload_tls_cert"`
+	LiveReloadTLSKey   string        `yaml:"live_reload_tls_key"`
+	LiveReloadURL      string        `yaml:"live_reload_url"`
+	PortEnv            string        `yaml:"port_env"`
+	Processes          []Process     `yaml:"processes"`
+	Services           []Service     `yaml:"services"`
+	Watch              []WatchRoot   `yaml:"watch"`
+	WatchAttribEvents  bool          `yaml:"watch_attrib_events"`
 	ReadynessURL       string        `yaml:"readyness_url"`
 	LogName            string        `yaml:"log_name"`
 	Debug              bool          `yaml:"-"`
+	JSONLogs           bool          `yaml:"-"`
 	Path               string        `yaml:"-"`
 	Stderr             io.Writer     `yaml:"-"`
 	Stdin              io.Reader     `yaml:"-"`
 	Stdout             io.Writer     `yaml:"-"`
 }
 
+// Process is a named process started from the build output.
+// All processes are restarted together after a build. Restart is the policy
+// if the process exits by itself: never (default), on-failure or always.
+type Process struct {
+	Name         string   `yaml:"name"`
+	CommandFlags []string `yaml:"command_flags"`
+	CommandEnv   []string `yaml:"command_env"`
+	Restart      string   `yaml:"restart"`
+	ReadynessURL string   `yaml:"readyness_url"`
+}
+
+const (
+	RestartNever     = "never"
+	RestartOnFailure = "on-failure"
+	RestartAlways    = "always"
+)
+
+// WatchRoot is an additional directory or file to watch with its own filters.
+// A relative path is resolved against the app root. Without included extensions or patterns all files are watched.
+// Action is what happens on a change: build (default), restart (without a build) or reload (notify live reload clients).
+type WatchRoot struct {
+	Path               string   `yaml:"path"`
+	Recursive          bool     `yaml:"recursive"`
+	IncludedExtensions []string `yaml:"included_extensions"`
+	IncludedPatterns   []string `yaml:"included_patterns"`
+	IgnoredFolders     []string `yaml:"ignored_folders"`
+	Action             string   `yaml:"action"`
+}
+
+// Service is a build target in multi-service mode.
+// Services share the watcher and all other settings of the configuration, but are built and run separately.
+// BinaryName defaults to the service name and CommandEnv is added to the environment of the configuration.
+type Service struct {
+	Name            string    `yaml:"name"`
+	BuildTargetPath string    `yaml:"build_target_path"`
+	BinaryName      string    `yaml:"binary_name"`
+	BuildFlags      []string  `yaml:"build_flags"`
+	CommandFlags    []string  `yaml:"command_flags"`
+	CommandEnv      []string  `yaml:"command_env"`
+	ReadynessURL    string    `yaml:"readyness_url"`
+	Processes       []Process `yaml:"processes"`
+}
+
+// ServiceConfiguration returns a copy of the configuration with the settings of the service applied
+func (c *Configuration) ServiceConfiguration(s Service) *Configuration {
+	sc := *c
+	sc.Services = nil
+	sc.BuildTargetPath = s.BuildTargetPath
+	sc.BinaryName = s.BinaryName
+	if sc.BinaryName == "" {
+		sc.BinaryName = s.Name
+	}
+	if s.BuildFlags != nil {
+		sc.BuildFlags = s.BuildFlags
+	}
+	sc.CommandFlags = s.CommandFlags
+	sc.CommandEnv = append(append([]string{}, c.CommandEnv...), s.CommandEnv...)
+	sc.ReadynessURL = s.ReadynessURL
+	sc.Processes = s.Processes
+	return &sc
+}
+
+// validateServices checks that every service has a unique name and binary, services with the same binary
+// would overwrite the builds of each other in the build path.
+func (c *Configuration) validateServices() error {
+	names := make(map[string]struct{}, len(c.Services))
+	binaries := make(map[string]string, len(c.Services))
+	for i, svc := range c.Services {
+		if svc.Name == "" {
+			return fmt.Errorf("service %d: missing name", i)
+		}
+		if _, exists := names[svc.Name]; exists {
+			return fmt.Errorf("service %q: duplicate name", svc.Name)
+		}
+		names[svc.Name] = struct{}{}
+
+		binary := c.ServiceConfiguration(svc).BinaryName
+		if other, exists := binaries[binary]; exists {
+			return fmt.Errorf("service %q: binary name %q is already used by service %q", svc.Name, binary, other)
+		}
+		binaries[binary] = svc.Name
+	}
+	return nil
+}
+
 func (c *Configuration) FullBuildPath() string {
 	buildPath := path.Join(c.BuildPath, c.BinaryName)
 	if runtime.GOOS == "windows" {
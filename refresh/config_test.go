@@ -0,0 +1,156 @@
+package refresh
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestConfiguration_ServiceConfiguration(t *testing.T) {
+	base := Configuration{
+		AppRoot:      "/app",
+		BuildPath:    "/tmp/build",
+		BinaryName:   "app",
+		BuildFlags:   []string{"-race"},
+		CommandFlags: []string{"serve"},
+		CommandEnv:   []string{"ENV=dev"},
+		ReadynessURL: "http://localhost:8080/",
+		Services:     []Service{{Name: "api"}, {Name: "worker"}},
+	}
+
+	tests := []struct {
+		name    string
+		service Service
+		check   func(t *testing.T, sc *Configuration)
+	}{
+		{
+			name:    "binary name defaults to the service name",
+			service: Service{Name: "api", BuildTargetPath: "./cmd/api"},
+			check: func(t *testing.T, sc *Configuration) {
+				if sc.BinaryName != "api" {
+					t.Errorf("BinaryName = %q, want %q", sc.BinaryName, "api")
+				}
+				if sc.BuildTargetPath != "./cmd/api" {
+					t.Errorf("BuildTargetPath = %q, want %q", sc.BuildTargetPath, "./cmd/api")
+				}
+			},
+		},
+		{
+			name:    "binary name of the service",
+			service: Service{Name: "api", BinaryName: "api-server"},
+			check: func(t *testing.T, sc *Configuration) {
+				if sc.BinaryName != "api-server" {
+					t.Errorf("BinaryName = %q, want %q", sc.BinaryName, "api-server")
+				}
+			},
+		},
+		{
+			name:    "build flags are inherited",
+			service: Service{Name: "api"},
+			check: func(t *testing.T, sc *Configuration) {
+				if !reflect.DeepEqual(sc.BuildFlags, []string{"-race"}) {
+					t.Errorf("BuildFlags = %v, want [-race]", sc.BuildFlags)
+				}
+			},
+		},
+		{
+			name:    "build flags of the service replace the inherited flags",
+			service: Service{Name: "api", BuildFlags: []string{"-tags=api"}},
+			check: func(t *testing.T, sc *Configuration) {
+				if !reflect.DeepEqual(sc.BuildFlags, []string{"-tags=api"}) {
+					t.Errorf("BuildFlags = %v, want [-tags=api]", sc.BuildFlags)
+				}
+			},
+		},
+		{
+			name:    "command env is added to the inherited env",
+			service: Service{Name: "api", CommandEnv: []string{"PORT=3000"}},
+			check: func(t *testing.T, sc *Configuration) {
+				if want := []string{"ENV=dev", "PORT=3000"}; !reflect.DeepEqual(sc.CommandEnv, want) {
+					t.Errorf("CommandEnv = %v, want %v", sc.CommandEnv, want)
+				}
+			},
+		},
+		{
+			name:    "command flags, readyness URL and processes are not inherited",
+			service: Service{Name: "api"},
+			check: func(t *testing.T, sc *Configuration) {
+				if sc.CommandFlags != nil || sc.ReadynessURL != "" || sc.Processes != nil {
+					t.Errorf("got command flags %v, readyness URL %q and processes %v, want none", sc.CommandFlags, sc.ReadynessURL, sc.Processes)
+				}
+			},
+		},
+		{
+			name:    "shared settings are kept",
+			service: Service{Name: "api"},
+			check: func(t *testing.T, sc *Configuration) {
+				if sc.AppRoot != "/app" || sc.BuildPath != "/tmp/build" {
+					t.Errorf("AppRoot = %q, BuildPath = %q, want shared settings", sc.AppRoot, sc.BuildPath)
+				}
+				if sc.Services != nil {
+					t.Errorf("Services = %v, want none", sc.Services)
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := base
+			tt.check(t, c.ServiceConfiguration(tt.service))
+
+			// The configuration of other services must not change
+			if !reflect.DeepEqual(c, base) {
+				t.Errorf("configuration changed to %+v", c)
+			}
+		})
+	}
+}
+
+func TestConfiguration_validateServices(t *testing.T) {
+	tests := []struct {
+		name     string
+		services []Service
+		wantErr  string
+	}{
+		{
+			name:     "unique services",
+			services: []Service{{Name: "api"}, {Name: "worker", BinaryName: "api-worker"}},
+		},
+		{
+			name:     "missing name",
+			services: []Service{{Name: "api"}, {BuildTargetPath: "./cmd/worker"}},
+			wantErr:  "service 1: missing name",
+		},
+		{
+			name:     "duplicate name",
+			services: []Service{{Name: "api"}, {Name: "worker"}, {Name: "api"}},
+			wantErr:  `service "api": duplicate name`,
+		},
+		{
+			name:     "duplicate binary name",
+			services: []Service{{Name: "api", BinaryName: "server"}, {Name: "worker", BinaryName: "server"}},
+			wantErr:  `service "worker": binary name "server" is already used by service "api"`,
+		},
+		{
+			name:     "binary name of another service name",
+			services: []Service{{Name: "api"}, {Name: "worker", BinaryName: "api"}},
+			wantErr:  `service "worker": binary name "api" is already used by service "api"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Configuration{Services: tt.services}
+			err := c.validateServices()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("validateServices() error = %v", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("validateServices() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
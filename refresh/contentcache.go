@@ -0,0 +1,120 @@
+package refresh
+
+import (
+	"container/list"
+	"crypto/md5"
+	"io"
+	"os"
+	"sync"
+)
+
+// contentCacheSize is the maximum number of files in the content cache, so memory stays bounded on large trees
+const contentCacheSize = 10000
+
+// contentCache remembers content hashes of files to detect events that did not change the content.
+// The least recently used entries are evicted if the cache is full.
+type contentCache struct {
+	mu      sync.Mutex
+	max     int
+	entries map[string]*list.Element
+	lru     *list.List
+}
+
+type contentCacheEntry struct {
+	path string
+	hash [md5.Size]byte
+}
+
+func newContentCache(max int) *contentCache {
+	return &contentCache{
+		max:     max,
+		entries: make(map[string]*list.Element),
+		lru:     list.New(),
+	}
+}
+
+// changed hashes the file and reports if the content differs from the last known content.
+// Files that were not seen before, cannot be read or were removed are always reported as changed.
+func (c *contentCache) changed(path string) bool {
+	hash, err := hashFile(path)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err != nil {
+		c.remove(path)
+		return true
+	}
+
+	if el, ok := c.entries[path]; ok {
+		entry := el.Value.(*contentCacheEntry)
+		c.lru.MoveToFront(el)
+		if entry.hash == hash {
+			return false
+		}
+		entry.hash = hash
+		return true
+	}
+
+	c.add(path, hash)
+	return true
+}
+
+// prime adds the hash of a file that is not yet known, it returns false if the cache is full
+func (c *contentCache) prime(path string) bool {
+	c.mu.Lock()
+	full := c.lru.Len() >= c.max
+	_, known := c.entries[path]
+	c.mu.Unlock()
+	if full {
+		return false
+	}
+	if known {
+		return true
+	}
+
+	hash, err := hashFile(path)
+	if err != nil {
+		return true
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, known := c.entries[path]; !known {
+		c.add(path, hash)
+	}
+	return true
+}
+
+func (c *contentCache) add(path string, hash [md5.Size]byte) {
+	c.entries[path] = c.lru.PushFront(&contentCacheEntry{path: path, hash: hash})
+	for c.lru.Len() > c.max {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*contentCacheEntry).path)
+	}
+}
+
+func (c *contentCache) remove(path string) {
+	if el, ok := c.entries[path]; ok {
+		c.lru.Remove(el)
+		delete(c.entries, path)
+	}
+}
+
+func hashFile(path string) ([md5.Size]byte, error) {
+	var hash [md5.Size]byte
+
+	f, err := os.Open(path)
+	if err != nil {
+		return hash, err
+	}
+	defer f.Close()
+
+	h := md5.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return hash, err
+	}
+	copy(hash[:], h.Sum(nil))
+	return hash, nil
+}
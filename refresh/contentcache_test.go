@@ -0,0 +1,69 @@
+package refresh
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestContentCache_changed(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "main.go")
+	writeFile(t, path, "package main")
+
+	c := newContentCache(10)
+
+	if !c.changed(path) {
+		t.Error("first event for unknown file should be reported as changed")
+	}
+	if c.changed(path) {
+		t.Error("event without content change should not be reported as changed")
+	}
+
+	writeFile(t, path, "package main\n")
+	if !c.changed(path) {
+		t.Error("event with content change should be reported as changed")
+	}
+
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	if !c.changed(path) {
+		t.Error("event for removed file should be reported as changed")
+	}
+
+	writeFile(t, path, "package main\n")
+	if !c.changed(path) {
+		t.Error("event for re-created file should be reported as changed")
+	}
+}
+
+func TestContentCache_bounded(t *testing.T) {
+	dir := t.TempDir()
+	c := newContentCache(2)
+
+	var paths []string
+	for _, name := range []string{"a.go", "b.go", "c.go"} {
+		path := filepath.Join(dir, name)
+		writeFile(t, path, name)
+		paths = append(paths, path)
+		c.changed(path)
+	}
+
+	if got := len(c.entries); got != 2 {
+		t.Fatalf("cache has %d entries, want 2", got)
+	}
+	if _, ok := c.entries[paths[0]]; ok {
+		t.Error("least recently used entry should have been evicted")
+	}
+	if c.prime(filepath.Join(dir, "d.go")) {
+		t.Error("prime should report a full cache")
+	}
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
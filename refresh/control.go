@@ -0,0 +1,328 @@
+package refresh
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/apex/log"
+)
+
+// controlShutdownTimeout is the time to wait for open requests when the control API is stopped
+const controlShutdownTimeout = 5 * time.Second
+
+// ControlInfo is written to the discovery file of the control API, so clients find the API of a running refresh
+type ControlInfo struct {
+	Network string `json:"network"`
+	Address string `json:"address"`
+	PID     int    `json:"pid"`
+	// Token has to be sent as a bearer token to a TCP address, so other users and web pages can't use the API
+	Token string `json:"token,omitempty"`
+}
+
+// ControlStatus is the response of the control API with the status of all services
+type ControlStatus struct {
+	PID      int      `json:"pid"`
+	Services []Status `json:"services"`
+}
+
+// ControlDiscoveryPath returns the path of the discovery file of the control API for the working directory
+func ControlDiscoveryPath() string {
+	return filepath.Join(os.TempDir(), "refresh-"+ID()+".json")
+}
+
+func defaultControlSocket() string {
+	return filepath.Join(os.TempDir(), "refresh-"+ID()+".sock")
+}
+
+// controlAddr returns the network and address of the control API, a unix socket is used by default
+func (c *Configuration) controlAddr() (network, address string) {
+	switch {
+	case c.ControlAddr == "":
+		return "unix", defaultControlSocket()
+	case strings.HasPrefix(c.ControlAddr, "unix:"):
+		return "unix", strings.TrimPrefix(c.ControlAddr, "unix:")
+	}
+	return "tcp", c.ControlAddr
+}
+
+// controlServer serves the control API for the managers of a run
+type controlServer struct {
+	managers []*Manager
+	logs     *logBuffer
+	stop     func()
+	// done is closed on shutdown to end streaming responses
+	done chan struct{}
+}
+
+// startControlServer starts the control API if enabled. The returned function shuts it down and removes the discovery file.
+func startControlServer(c *Configuration, managers []*Manager, stop func()) (shutdown func(), err error) {
+	if !c.Control && c.ControlAddr == "" {
+		return func() {}, nil
+	}
+
+	network, address := c.controlAddr()
+	if network == "unix" {
+		// A socket of another refresh might still be in use, otherwise it is left from a crashed run
+		if conn, err := net.Dial("unix", address); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("control API socket %s is used by another refresh", address)
+		}
+		_ = os.Remove(address)
+	}
+
+	l, err := net.Listen(network, address)
+	if err != nil {
+		return nil, fmt.Errorf("starting control API on %s: %w", address, err)
+	}
+	token := ""
+	if network == "unix" {
+		_ = os.Chmod(address, 0600)
+	} else {
+		address = l.Addr().String()
+		token, err = controlToken()
+		if err != nil {
+			l.Close()
+			return nil, err
+		}
+	}
+
+	discoveryPath := ControlDiscoveryPath()
+	info, _ := json.Marshal(ControlInfo{
+		Network: network,
+		Address: address,
+		PID:     os.Getpid(),
+		Token:   token,
+	})
+	err = os.WriteFile(discoveryPath, info, 0600)
+	if err != nil {
+		l.Close()
+		return nil, fmt.Errorf("writing control API discovery file: %w", err)
+	}
+
+	s := &controlServer{
+		managers: managers,
+		logs:     newLogBuffer(logBufferSize),
+		stop:     stop,
+		done:     make(chan struct{}),
+	}
+	for _, m := range managers {
+		m.logs = s.logs
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/status", s.handleStatus)
+	mux.HandleFunc("/rebuild", s.handleAction(func(m *Manager) error {
+		m.TriggerBuild("api")
+		return nil
+	}))
+	mux.HandleFunc("/restart", s.handleAction(func(m *Manager) error {
+		return m.TriggerRestart("api")
+	}))
+	mux.HandleFunc("/rollback", s.handleAction(func(m *Manager) error {
+		return m.Rollback()
+	}))
+	mux.HandleFunc("/pause", s.handleAction(func(m *Manager) error {
+		m.Pause()
+		return nil
+	}))
+	mux.HandleFunc("/resume", s.handleAction(func(m *Manager) error {
+		m.Resume()
+		return nil
+	}))
+	mux.HandleFunc("/stop", s.handleStop)
+	mux.HandleFunc("/logs", s.handleLogs)
+
+	srv := &http.Server{Handler: authorizeControl(token, mux)}
+	go func() {
+		err := srv.Serve(l)
+		if err != nil && err != http.ErrServerClosed {
+			log.WithError(err).Error("control: Server failed")
+		}
+	}()
+
+	log.
+		WithField("network", network).
+		Infof("Control API listening on %s", address)
+
+	return func() {
+		close(s.done)
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), controlShutdownTimeout)
+		defer cancel()
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			log.WithError(err).Warn("control: Failed to shut down server")
+		}
+		_ = os.Remove(discoveryPath)
+		if network == "unix" {
+			_ = os.Remove(address)
+		}
+		log.Debug("control: Stopped server")
+	}, nil
+}
+
+// controlToken generates a random token for authorizing requests to the control API
+func controlToken() (string, error) {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", fmt.Errorf("generating control API token: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// authorizeControl checks the bearer token of requests if a token is set
+func authorizeControl(token string, next http.Handler) http.Handler {
+	if token == "" {
+		return next
+	}
+	want := []byte("Bearer " + token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), want) != 1 {
+			writeControlError(w, http.StatusUnauthorized, errors.New("invalid or missing token"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *controlServer) status() ControlStatus {
+	status := ControlStatus{
+		PID:      os.Getpid(),
+		Services: make([]Status, 0, len(s.managers)),
+	}
+	for _, m := range s.managers {
+		status.Services = append(status.Services, m.Status())
+	}
+	return status
+}
+
+func (s *controlServer) handleStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeControlError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+	writeControlJSON(w, http.StatusOK, s.status())
+}
+
+// handleAction runs the action for all managers or the service given in the service query parameter
+func (s *controlServer) handleAction(action func(m *Manager) error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			writeControlError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+			return
+		}
+
+		managers, err := s.selectManagers(r.URL.Query().Get("service"))
+		if err != nil {
+			writeControlError(w, http.StatusNotFound, err)
+			return
+		}
+		for _, m := range managers {
+			err := action(m)
+			if err != nil {
+				writeControlError(w, http.StatusConflict, err)
+				return
+			}
+		}
+
+		log.Debugf("control: %s", r.URL.Path)
+
+		writeControlJSON(w, http.StatusOK, s.status())
+	}
+}
+
+func (s *controlServer) handleStop(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeControlError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+
+	log.Info("Stopping by control API")
+
+	writeControlJSON(w, http.StatusOK, s.status())
+	// Stop after the response was sent, stopping shuts down the control API
+	go s.stop()
+}
+
+// handleLogs writes the last lines of the output (all by default or the lines query parameter),
+// with the follow query parameter new lines are streamed until the client disconnects
+func (s *controlServer) handleLogs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeControlError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+
+	n := 0
+	if v := r.URL.Query().Get("lines"); v != "" {
+		var err error
+		n, err = strconv.Atoi(v)
+		if err != nil {
+			writeControlError(w, http.StatusBadRequest, fmt.Errorf("invalid lines: %w", err))
+			return
+		}
+	}
+	follow, _ := strconv.ParseBool(r.URL.Query().Get("follow"))
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+
+	if !follow {
+		for _, line := range s.logs.tail(n) {
+			fmt.Fprintln(w, line)
+		}
+		return
+	}
+
+	tail, lines, cancel := s.logs.follow(n)
+	defer cancel()
+	for _, line := range tail {
+		fmt.Fprintln(w, line)
+	}
+	flusher, _ := w.(http.Flusher)
+	for {
+		if flusher != nil {
+			flusher.Flush()
+		}
+		select {
+		case line := <-lines:
+			fmt.Fprintln(w, line)
+		case <-r.Context().Done():
+			return
+		case <-s.done:
+			return
+		}
+	}
+}
+
+func (s *controlServer) selectManagers(service string) ([]*Manager, error) {
+	if service == "" {
+		return s.managers, nil
+	}
+	for _, m := range s.managers {
+		if m.Name == service {
+			return []*Manager{m}, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown service %q", service)
+}
+
+func writeControlJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeControlError(w http.ResponseWriter, code int, err error) {
+	writeControlJSON(w, code, struct {
+		Error string `json:"error"`
+	}{err.Error()})
+}
@@ -0,0 +1,189 @@
+package refresh
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestControlServer(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	c := &Configuration{AppRoot: t.TempDir(), BuildPath: t.TempDir(), BinaryName: "app", ControlAddr: "127.0.0.1:0"}
+	m := NewWithContext(c, ctx)
+	m.Name = "api"
+	stopped := make(chan struct{})
+	shutdown, err := startControlServer(c, []*Manager{m}, func() { close(stopped) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer shutdown()
+
+	client, err := NewControlClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if client.Info.Network != "tcp" || client.Info.Token == "" {
+		t.Fatalf("discovery info = %+v, want a TCP address with a token", client.Info)
+	}
+
+	status, err := client.Status(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(status.Services) != 1 || status.Services[0].Service != "api" {
+		t.Errorf("status = %+v, want the service api", status)
+	}
+
+	if _, err := client.Action(ctx, "pause", "api"); err != nil {
+		t.Fatal(err)
+	}
+	if !m.Status().Paused {
+		t.Error("service is not paused")
+	}
+	if _, err := client.Action(ctx, "pause", "web"); err == nil {
+		t.Error("action for unknown service should fail")
+	}
+	if _, err := client.Action(ctx, "rollback", ""); err == nil || !strings.Contains(err.Error(), "build history is not enabled") {
+		t.Errorf("rollback without build history = %v, want an error", err)
+	}
+
+	if _, err := client.Action(ctx, "stop", ""); err != nil {
+		t.Fatal(err)
+	}
+	<-stopped
+}
+
+func TestControlServer_restart(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	c := &Configuration{AppRoot: t.TempDir(), BuildPath: t.TempDir(), BinaryName: "app", Control: true}
+	m := NewWithContext(c, ctx)
+	shutdown, err := startControlServer(c, []*Manager{m}, func() {})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer shutdown()
+
+	client, err := NewControlClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The runner is busy (e.g. waiting for the app to be ready), the restart is only requested
+	reqCtx, reqCancel := context.WithTimeout(ctx, 5*time.Second)
+	defer reqCancel()
+	for i := 0; i < 2; i++ {
+		if _, err := client.Action(reqCtx, "restart", ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	select {
+	case <-m.Restart:
+	case <-time.After(5 * time.Second):
+		t.Fatal("restart was not requested")
+	}
+	// Requests while a restart is pending are coalesced
+	select {
+	case <-m.Restart:
+		t.Error("restart requested twice")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestControlClient_timeout(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+
+	// A refresh that accepts connections but never responds
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	info, _ := json.Marshal(ControlInfo{Network: "tcp", Address: l.Addr().String()})
+	if err := os.WriteFile(ControlDiscoveryPath(), info, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	client, err := NewControlClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if _, err := client.Status(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Status() = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestControlClient_notRunning(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+
+	if _, err := NewControlClient(); !errors.Is(err, ErrNotRunning) {
+		t.Errorf("NewControlClient() without discovery file = %v, want %v", err, ErrNotRunning)
+	}
+}
+
+func TestControlServer_unauthorized(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	c := &Configuration{AppRoot: t.TempDir(), BuildPath: t.TempDir(), BinaryName: "app", ControlAddr: "127.0.0.1:0"}
+	shutdown, err := startControlServer(c, []*Manager{NewWithContext(c, ctx)}, func() {})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer shutdown()
+
+	client, err := NewControlClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, token := range []string{"", "wrong"} {
+		req, err := http.NewRequest(http.MethodPost, "http://"+client.Info.Address+"/stop", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Close = true
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusUnauthorized {
+			t.Errorf("status with token %q = %d, want %d", token, resp.StatusCode, http.StatusUnauthorized)
+		}
+	}
+
+	// The client reports the error of the API
+	client.Info.Token = "wrong"
+	if _, err := client.Status(ctx); err == nil || err.Error() != "invalid or missing token" {
+		t.Errorf("Status() with wrong token = %v, want invalid or missing token", err)
+	}
+}
@@ -0,0 +1,139 @@
+package refresh
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+)
+
+// ErrNotRunning is returned if no running refresh with a control API was found for the working directory
+var ErrNotRunning = errors.New("no running refresh with control API found for this directory")
+
+// ControlClient talks to the control API of a running refresh
+type ControlClient struct {
+	Info   ControlInfo
+	client *http.Client
+}
+
+// NewControlClient finds the control API of the refresh running in the working directory by its discovery file
+func NewControlClient() (*ControlClient, error) {
+	data, err := os.ReadFile(ControlDiscoveryPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotRunning
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading control API discovery file: %w", err)
+	}
+
+	var info ControlInfo
+	err = json.Unmarshal(data, &info)
+	if err != nil {
+		return nil, fmt.Errorf("parsing control API discovery file: %w", err)
+	}
+
+	return &ControlClient{
+		Info: info,
+		client: &http.Client{
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					var d net.Dialer
+					return d.DialContext(ctx, info.Network, info.Address)
+				},
+			},
+		},
+	}, nil
+}
+
+// Status returns the status of all services
+func (c *ControlClient) Status(ctx context.Context) (ControlStatus, error) {
+	return c.do(ctx, http.MethodGet, "/status", nil)
+}
+
+// Action runs an action (rebuild, restart, pause, resume or stop) for all services or the given service
+func (c *ControlClient) Action(ctx context.Context, action, service string) (ControlStatus, error) {
+	query := url.Values{}
+	if service != "" {
+		query.Set("service", service)
+	}
+	return c.do(ctx, http.MethodPost, "/"+action, query)
+}
+
+// Logs writes the last lines of the output of the app to w, with follow new lines are written until the context is done
+func (c *ControlClient) Logs(ctx context.Context, w io.Writer, lines int, follow bool) error {
+	query := url.Values{}
+	if lines > 0 {
+		query.Set("lines", strconv.Itoa(lines))
+	}
+	if follow {
+		query.Set("follow", "true")
+	}
+
+	resp, err := c.request(ctx, http.MethodGet, "/logs", query)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	_, err = io.Copy(w, resp.Body)
+	if err != nil && ctx.Err() != nil {
+		return nil
+	}
+	return err
+}
+
+func (c *ControlClient) do(ctx context.Context, method, path string, query url.Values) (ControlStatus, error) {
+	var status ControlStatus
+
+	resp, err := c.request(ctx, method, path, query)
+	if err != nil {
+		return status, err
+	}
+	defer resp.Body.Close()
+
+	err = json.NewDecoder(resp.Body).Decode(&status)
+	if err != nil {
+		return status, fmt.Errorf("decoding response: %w", err)
+	}
+	return status, nil
+}
+
+func (c *ControlClient) request(ctx context.Context, method, path string, query url.Values) (*http.Response, error) {
+	// The host is ignored, connections are made to the address of the discovery file
+	u := url.URL{Scheme: "http", Host: "refresh", Path: path, RawQuery: query.Encode()}
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if c.Info.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Info.Token)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		// The discovery file is left if refresh was killed
+		var opErr *net.OpError
+		if errors.As(err, &opErr) && opErr.Op == "dial" {
+			return nil, ErrNotRunning
+		}
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		var body struct {
+			Error string `json:"error"`
+		}
+		if json.NewDecoder(resp.Body).Decode(&body) == nil && body.Error != "" {
+			return nil, errors.New(body.Error)
+		}
+		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+	return resp, nil
+}
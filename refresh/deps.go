@@ -0,0 +1,107 @@
+package refresh
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// goListPackage is the part of the `go list -json` output needed to map changed files to packages
+type goListPackage struct {
+	ImportPath string
+	Dir        string
+	Standard   bool
+}
+
+// listDeps returns the directories of all non-standard packages the build target transitively depends on
+func (r *Manager) listDeps() (map[string]struct{}, error) {
+	target := r.BuildTargetPath
+	if target == "" {
+		target = "."
+	}
+
+	// Use -e to get the dependencies even if some packages have errors
+	args := []string{"list", "-e", "-deps", "-json"}
+	args = append(args, r.BuildFlags...)
+	args = append(args, target)
+	cmd := exec.CommandContext(r.context, "go", args...)
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("%s\n%s", err, stderr.String())
+	}
+
+	deps := make(map[string]struct{})
+	dec := json.NewDecoder(bytes.NewReader(out))
+	for {
+		var pkg goListPackage
+		err := dec.Decode(&pkg)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("decoding go list output: %w", err)
+		}
+		if pkg.Standard || pkg.Dir == "" {
+			continue
+		}
+		deps[realDir(pkg.Dir)] = struct{}{}
+	}
+	return deps, nil
+}
+
+// updateDeps refreshes the set of packages the build target depends on
+func (r *Manager) updateDeps() {
+	deps, err := r.listDeps()
+	if err != nil {
+		r.logger().WithError(err).Warn("Listing dependencies failed, building on every change")
+	}
+
+	r.depsMx.Lock()
+	r.deps = deps
+	r.depsMx.Unlock()
+
+	r.logger().
+		WithField("packages", len(deps)).
+		Debug("Updated dependencies")
+}
+
+// affectedBy checks if a watch event can affect the build target.
+// Only changes of Go files in packages that are not dependencies of the target are considered unrelated,
+// since other files might be embedded or read at runtime.
+func (r *Manager) affectedBy(event WatchEvent) bool {
+	if filepath.Ext(event.Path) != ".go" {
+		return true
+	}
+	if strings.HasSuffix(event.Path, "_test.go") {
+		return false
+	}
+
+	r.depsMx.RLock()
+	defer r.depsMx.RUnlock()
+
+	// Dependencies are not known (yet)
+	if r.deps == nil {
+		return true
+	}
+
+	_, ok := r.deps[realDir(filepath.Dir(event.Path))]
+	return ok
+}
+
+// realDir returns the absolute directory with symlinks resolved, so paths from go list and the watcher can be compared
+func realDir(dir string) string {
+	if abs, err := filepath.Abs(dir); err == nil {
+		dir = abs
+	}
+	if real, err := filepath.EvalSymlinks(dir); err == nil {
+		dir = real
+	}
+	return dir
+}
@@ -0,0 +1,63 @@
+package refresh
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestManager_affectedBy(t *testing.T) {
+	dir := t.TempDir()
+	depDir := realDir(filepath.Join(dir, "lib"))
+
+	tests := []struct {
+		name string
+		deps map[string]struct{}
+		path string
+		want bool
+	}{
+		{
+			name: "unknown dependencies affect everything",
+			path: filepath.Join(dir, "tools", "gen.go"),
+			want: true,
+		},
+		{
+			name: "go file in dependency",
+			deps: map[string]struct{}{depDir: {}},
+			path: filepath.Join(dir, "lib", "lib.go"),
+			want: true,
+		},
+		{
+			name: "go file in unrelated package",
+			deps: map[string]struct{}{depDir: {}},
+			path: filepath.Join(dir, "tools", "gen.go"),
+			want: false,
+		},
+		{
+			name: "test file in dependency",
+			deps: map[string]struct{}{depDir: {}},
+			path: filepath.Join(dir, "lib", "lib_test.go"),
+			want: false,
+		},
+		{
+			name: "non-go file outside of dependencies",
+			deps: map[string]struct{}{depDir: {}},
+			path: filepath.Join(dir, "templates", "index.html"),
+			want: true,
+		},
+		{
+			name: "module file",
+			deps: map[string]struct{}{depDir: {}},
+			path: filepath.Join(dir, "go.mod"),
+			want: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &Manager{deps: tt.deps}
+			if got := r.affectedBy(WatchEvent{Path: tt.path}); got != tt.want {
+				t.Errorf("affectedBy(%q) = %v, want %v", tt.path, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,152 @@
+package refresh
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+)
+
+// Diagnostic is an error reported by go build
+type Diagnostic struct {
+	Package string `json:"package,omitempty"`
+	File    string `json:"file"`
+	Line    int    `json:"line"`
+	Column  int    `json:"column,omitempty"`
+	Message string `json:"message"`
+}
+
+func (d Diagnostic) Position() string {
+	if d.Column > 0 {
+		return fmt.Sprintf("%s:%d:%d", d.File, d.Line, d.Column)
+	}
+	return fmt.Sprintf("%s:%d", d.File, d.Line)
+}
+
+// BuildError is returned if go build failed, with the diagnostics parsed from its output
+type BuildError struct {
+	Err         error
+	Output      string
+	Diagnostics []Diagnostic
+}
+
+func (e *BuildError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *BuildError) Unwrap() error {
+	return e.Err
+}
+
+// BuildResult is the result of a build
+type BuildResult struct {
+	Success     bool          `json:"success"`
+	Time        time.Time     `json:"time"`
+	Duration    time.Duration `json:"duration"`
+	TriggerPath string        `json:"triggerPath"`
+	Diagnostics []Diagnostic  `json:"diagnostics,omitempty"`
+	// Output is the raw output of a failed build without diagnostics
+	Output string `json:"output,omitempty"`
+}
+
+// diagnosticPattern matches errors with a position, also in C files of cgo packages and in go.mod
+var diagnosticPattern = regexp.MustCompile(`^(\S.*?\.\w+):(\d+)(?::(\d+))?: (.+)$`)
+
+// parseDiagnostics parses the output of go build into diagnostics.
+// File paths are made relative to the root directory if they are inside of it.
+func parseDiagnostics(output string, root string) []Diagnostic {
+	var (
+		diagnostics []Diagnostic
+		pkg         string
+		seen        = make(map[Diagnostic]struct{})
+		// current is the index of the diagnostic continued by indented lines, -1 after a dropped duplicate
+		current = -1
+	)
+
+	absRoot, _ := filepath.Abs(root)
+
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimRight(line, "\r")
+
+		if strings.HasPrefix(line, "# ") {
+			pkg = strings.TrimPrefix(line, "# ")
+			continue
+		}
+
+		// Indented lines continue the message of the previous diagnostic (e.g. have / want of a type error)
+		if strings.HasPrefix(line, "\t") {
+			if current >= 0 {
+				diagnostics[current].Message += "\n" + strings.TrimSpace(line)
+			}
+			continue
+		}
+
+		m := diagnosticPattern.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+
+		d := Diagnostic{
+			Package: pkg,
+			File:    relativePath(absRoot, m[1]),
+			Message: m[4],
+		}
+		d.Line, _ = strconv.Atoi(m[2])
+		if m[3] != "" {
+			d.Column, _ = strconv.Atoi(m[3])
+		}
+
+		if _, exists := seen[d]; exists {
+			current = -1
+			continue
+		}
+		seen[d] = struct{}{}
+		diagnostics = append(diagnostics, d)
+		current = len(diagnostics) - 1
+	}
+
+	return diagnostics
+}
+
+func relativePath(absRoot, path string) string {
+	abs, err := filepath.Abs(path)
+	if err != nil || absRoot == "" {
+		return path
+	}
+	if !isWithin(absRoot, abs) {
+		return abs
+	}
+	rel, _ := filepath.Rel(absRoot, abs)
+	return rel
+}
+
+// printDiagnostics writes a compact summary of the diagnostics
+func printDiagnostics(w io.Writer, diagnostics []Diagnostic) {
+	pos := color.New(color.Bold)
+	msg := color.New(color.FgRed)
+	pkg := color.New(color.Faint)
+
+	errorsLabel := "errors"
+	if len(diagnostics) == 1 {
+		errorsLabel = "error"
+	}
+	msg.Fprintf(w, "Build failed with %d %s:\n", len(diagnostics), errorsLabel)
+
+	lastPkg := ""
+	for _, d := range diagnostics {
+		if d.Package != lastPkg {
+			pkg.Fprintf(w, "  %s\n", d.Package)
+			lastPkg = d.Package
+		}
+		lines := strings.Split(d.Message, "\n")
+		fmt.Fprintf(w, "    %s %s\n", pos.Sprint(d.Position()), msg.Sprint(lines[0]))
+		for _, l := range lines[1:] {
+			fmt.Fprintf(w, "      %s\n", l)
+		}
+	}
+}
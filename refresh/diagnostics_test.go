@@ -0,0 +1,132 @@
+package refresh
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseDiagnostics(t *testing.T) {
+	root, err := filepath.Abs(".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	outside := filepath.Join(filepath.Dir(root), "lib", "lib.go")
+
+	output := `example.com/app/sub
+# example.com/app/sub
+sub/sub.go:3:23: cannot use "x" (untyped string constant) as int value in return statement
+# example.com/app
+./main.go:9:14: undefined: undefinedVar
+./main.go:11:6: cannot use x (variable of type int) as string value in argument to foo
+	have (int)
+	want (string)
+./main.go:9:14: undefined: undefinedVar
+./main.go:11:6: cannot use x (variable of type int) as string value in argument to foo
+	have (int)
+	want (string)
+` + outside + `:7: syntax error: unexpected newline
+main.go:12:2: too many errors
+`
+
+	want := []Diagnostic{
+		{Package: "example.com/app/sub", File: filepath.Join("sub", "sub.go"), Line: 3, Column: 23, Message: `cannot use "x" (untyped string constant) as int value in return statement`},
+		{Package: "example.com/app", File: "main.go", Line: 9, Column: 14, Message: "undefined: undefinedVar"},
+		{Package: "example.com/app", File: "main.go", Line: 11, Column: 6, Message: "cannot use x (variable of type int) as string value in argument to foo\nhave (int)\nwant (string)"},
+		{Package: "example.com/app", File: outside, Line: 7, Message: "syntax error: unexpected newline"},
+		{Package: "example.com/app", File: "main.go", Line: 12, Column: 2, Message: "too many errors"},
+	}
+
+	got := parseDiagnostics(output, ".")
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseDiagnostics() =\n%#v\nwant\n%#v", got, want)
+	}
+}
+
+func TestParseDiagnostics_otherFiles(t *testing.T) {
+	output := `# example.com/app/native
+native/hash.c:12:5: error: unknown type name 'uint128'
+In file included from native/hash.c:1:
+go: errors parsing go.mod:
+go.mod:5: unknown directive: requir
+`
+
+	want := []Diagnostic{
+		{Package: "example.com/app/native", File: filepath.Join("native", "hash.c"), Line: 12, Column: 5, Message: "error: unknown type name 'uint128'"},
+		{Package: "example.com/app/native", File: "go.mod", Line: 5, Message: "unknown directive: requir"},
+	}
+
+	got := parseDiagnostics(output, ".")
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseDiagnostics() =\n%#v\nwant\n%#v", got, want)
+	}
+}
+
+func TestParseDiagnostics_noDiagnostics(t *testing.T) {
+	got := parseDiagnostics("go: cannot find main module, but found .git/config\n", ".")
+	if len(got) != 0 {
+		t.Errorf("parseDiagnostics() = %#v, want none", got)
+	}
+}
+
+func TestManager_logBuildError(t *testing.T) {
+	tests := []struct {
+		name     string
+		jsonLogs bool
+		want     string
+	}{
+		{name: "text", want: "main.go:9:14 undefined: undefinedVar"},
+		{name: "json", jsonLogs: true, want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			var stderr bytes.Buffer
+			r := NewWithContext(&Configuration{Stderr: &stderr, JSONLogs: tt.jsonLogs}, ctx)
+			r.logBuildError(&BuildError{
+				Err:         errors.New("exit status 1"),
+				Diagnostics: []Diagnostic{{Package: "example.com/app", File: "main.go", Line: 9, Column: 14, Message: "undefined: undefinedVar"}},
+			})
+
+			got := stderr.String()
+			if tt.want == "" && got != "" {
+				t.Errorf("stderr = %q, want no output", got)
+			}
+			if !strings.Contains(got, tt.want) {
+				t.Errorf("stderr = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRelativePath(t *testing.T) {
+	root, err := filepath.Abs("testdata")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		path string
+		want string
+	}{
+		{name: "within root", path: filepath.Join(root, "sub", "main.go"), want: filepath.Join("sub", "main.go")},
+		{name: "name starting with dots", path: filepath.Join(root, "..main.go"), want: "..main.go"},
+		{name: "outside root", path: filepath.Join(filepath.Dir(root), "main.go"), want: filepath.Join(filepath.Dir(root), "main.go")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := relativePath(root, tt.path); got != tt.want {
+				t.Errorf("relativePath() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
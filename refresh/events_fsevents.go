@@ -0,0 +1,8 @@
+//go:build darwin && !kqueue && cgo
+
+package refresh
+
+import "github.com/rjeczalik/notify"
+
+// attribEvent is the platform event for changes of permissions, ownership and other metadata
+const attribEvent notify.Event = notify.FSEventsInodeMetaMod | notify.FSEventsChangeOwner | notify.FSEventsXattrMod
@@ -0,0 +1,8 @@
+//go:build (darwin && kqueue) || (darwin && !cgo) || dragonfly || freebsd || netbsd || openbsd
+
+package refresh
+
+import "github.com/rjeczalik/notify"
+
+// attribEvent is the platform event for changes of permissions, ownership and other metadata
+const attribEvent = notify.NoteAttrib
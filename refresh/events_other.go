@@ -0,0 +1,8 @@
+//go:build !darwin && !linux && !freebsd && !dragonfly && !netbsd && !openbsd && !windows && !solaris && !illumos
+
+package refresh
+
+import "github.com/rjeczalik/notify"
+
+// attribEvent is not supported on this platform
+const attribEvent notify.Event = 0
@@ -0,0 +1,116 @@
+package refresh
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/apex/log"
+)
+
+// gitPollInterval is the interval for checking if a git operation is in progress
+const gitPollInterval = 200 * time.Millisecond
+
+// staleIndexLockTimeout is the time after which a warning is logged if the index is still locked,
+// the lock might be left by a crashed git command
+const staleIndexLockTimeout = 10 * time.Second
+
+// gitMarkers are files and directories in the git dir that exist while an operation is in progress, in order of precedence
+var gitMarkers = []string{
+	"rebase-merge",
+	"rebase-apply",
+	"MERGE_HEAD",
+	"CHERRY_PICK_HEAD",
+	"REVERT_HEAD",
+	"BISECT_LOG",
+	"index.lock",
+}
+
+// findGitDir returns the git dir of the repository containing dir or an empty string if there is none.
+// For worktrees and submodules the .git file points to the git dir.
+func findGitDir(dir string) string {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return ""
+	}
+	for {
+		p := filepath.Join(dir, ".git")
+		fi, err := os.Stat(p)
+		if err == nil {
+			if fi.IsDir() {
+				return p
+			}
+			data, err := os.ReadFile(p)
+			if err != nil {
+				return ""
+			}
+			gitDir := strings.TrimSpace(strings.TrimPrefix(string(data), "gitdir:"))
+			if !filepath.IsAbs(gitDir) {
+				gitDir = filepath.Join(dir, gitDir)
+			}
+			return gitDir
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// gitOperation returns the marker of the git operation in progress or an empty string
+func gitOperation(gitDir string) string {
+	for _, marker := range gitMarkers {
+		if _, err := os.Lstat(filepath.Join(gitDir, marker)); err == nil {
+			return marker
+		}
+	}
+	return ""
+}
+
+// watchGitOperations holds builds of the managers while a git operation is in progress, until the context is done
+func watchGitOperations(ctx context.Context, c *Configuration, managers []*Manager) {
+	if !c.GitPause {
+		return
+	}
+	gitDir := findGitDir(c.AppRoot)
+	if gitDir == "" {
+		log.Debug("No git repository found, not pausing during git operations")
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(gitPollInterval)
+		defer ticker.Stop()
+
+		current := ""
+		var since time.Time
+		warned := false
+		for {
+			select {
+			case <-ticker.C:
+				op := gitOperation(gitDir)
+				if op == current {
+					if op == "index.lock" && !warned && time.Since(since) > staleIndexLockTimeout {
+						warned = true
+						log.
+							WithField("path", filepath.Join(gitDir, op)).
+							Warn("Git index is still locked, builds are held until the lock file is removed")
+					}
+					continue
+				}
+				current = op
+				since = time.Now()
+				warned = false
+				for _, m := range managers {
+					m.setGitOperation(op)
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
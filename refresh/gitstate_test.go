@@ -0,0 +1,87 @@
+package refresh
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestGitOperation(t *testing.T) {
+	tests := []struct {
+		name    string
+		markers []string
+		want    string
+	}{
+		{
+			name: "no operation",
+			want: "",
+		},
+		{
+			name:    "rebase",
+			markers: []string{"rebase-merge/"},
+			want:    "rebase-merge",
+		},
+		{
+			name:    "merge",
+			markers: []string{"MERGE_HEAD"},
+			want:    "MERGE_HEAD",
+		},
+		{
+			name:    "bisect",
+			markers: []string{"BISECT_LOG"},
+			want:    "BISECT_LOG",
+		},
+		{
+			name:    "rebase takes precedence over index lock",
+			markers: []string{"index.lock", "rebase-apply/"},
+			want:    "rebase-apply",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gitDir := t.TempDir()
+			for _, m := range tt.markers {
+				p := filepath.Join(gitDir, m)
+				if filepath.Base(m) != m {
+					if err := os.Mkdir(p, 0755); err != nil {
+						t.Fatal(err)
+					}
+					continue
+				}
+				writeFile(t, p, "")
+			}
+
+			if got := gitOperation(gitDir); got != tt.want {
+				t.Errorf("gitOperation() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFindGitDir(t *testing.T) {
+	root := t.TempDir()
+	repo := filepath.Join(root, "repo")
+	if err := os.MkdirAll(filepath.Join(repo, ".git"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	app := filepath.Join(repo, "cmd", "app")
+	if err := os.MkdirAll(app, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := findGitDir(app), filepath.Join(repo, ".git"); got != want {
+		t.Errorf("findGitDir() = %q, want %q", got, want)
+	}
+
+	// A worktree has a .git file pointing to its git dir
+	worktree := filepath.Join(root, "worktree")
+	if err := os.Mkdir(worktree, 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(worktree, ".git"), "gitdir: ../repo/.git/worktrees/wt\n")
+
+	if got, want := findGitDir(worktree), filepath.Join(repo, ".git", "worktrees", "wt"); got != want {
+		t.Errorf("findGitDir() for worktree = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,295 @@
+package refresh
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Build is the metadata of a successful build in the build history
+type Build struct {
+	ID           int           `json:"id"`
+	Path         string        `json:"path"`
+	TriggerPath  string        `json:"triggerPath"`
+	TriggerEvent string        `json:"triggerEvent"`
+	Commit       string        `json:"commit,omitempty"`
+	Time         time.Time     `json:"time"`
+	Duration     time.Duration `json:"duration"`
+}
+
+// buildHistory keeps copies of the last successful binaries, so the app can be restarted on a previous build
+type buildHistory struct {
+	mu     sync.Mutex
+	dir    string
+	max    int
+	builds []Build
+	lastID int
+}
+
+// historyIndexFile lists the builds of the history, only files listed there are removed from the directory
+const historyIndexFile = "index.json"
+
+func newBuildHistory(dir string, max int) (*buildHistory, error) {
+	// Binaries of a previous run are not used anymore
+	err := cleanBuildHistory(dir)
+	if err != nil {
+		return nil, fmt.Errorf("cleaning build history: %w", err)
+	}
+	err = os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, fmt.Errorf("creating build history: %w", err)
+	}
+	return &buildHistory{
+		dir: dir,
+		max: max,
+	}, nil
+}
+
+// cleanBuildHistory removes the binaries and the index of a previous run. The directory must only contain
+// files of the history, so a misconfigured build path never deletes anything else.
+func cleanBuildHistory(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var builds []Build
+	data, err := os.ReadFile(filepath.Join(dir, historyIndexFile))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err == nil {
+		err = json.Unmarshal(data, &builds)
+		if err != nil {
+			return fmt.Errorf("reading %s: %w", historyIndexFile, err)
+		}
+	}
+
+	owned := map[string]bool{historyIndexFile: true}
+	for _, b := range builds {
+		if filepath.Dir(b.Path) == filepath.Clean(dir) {
+			owned[filepath.Base(b.Path)] = true
+		}
+	}
+	for _, e := range entries {
+		if !owned[e.Name()] {
+			return fmt.Errorf("%s contains files that are not part of the build history (%s)", dir, e.Name())
+		}
+	}
+
+	for _, e := range entries {
+		err := os.Remove(filepath.Join(dir, e.Name()))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// add copies the binary to the history and removes the oldest builds exceeding the maximum
+func (h *buildHistory) add(binary string, b Build) (Build, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.lastID++
+	b.ID = h.lastID
+	b.Path = filepath.Join(h.dir, strconv.Itoa(b.ID)+filepath.Ext(binary))
+	err := copyFile(binary, b.Path)
+	if err != nil {
+		return b, fmt.Errorf("copying binary to build history: %w", err)
+	}
+
+	h.builds = append(h.builds, b)
+	for len(h.builds) > h.max {
+		_ = os.Remove(h.builds[0].Path)
+		h.builds = h.builds[1:]
+	}
+
+	return b, h.writeIndex()
+}
+
+// list returns the builds, newest first
+func (h *buildHistory) list() []Build {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	builds := make([]Build, len(h.builds))
+	for i, b := range h.builds {
+		builds[len(h.builds)-1-i] = b
+	}
+	return builds
+}
+
+func (h *buildHistory) get(id int) (Build, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, b := range h.builds {
+		if b.ID == id {
+			return b, true
+		}
+	}
+	return Build{}, false
+}
+
+// previous returns the newest build before the build with the given ID
+func (h *buildHistory) previous(id int) (Build, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for i := len(h.builds) - 1; i >= 0; i-- {
+		if h.builds[i].ID < id {
+			return h.builds[i], true
+		}
+	}
+	return Build{}, false
+}
+
+func (h *buildHistory) writeIndex() error {
+	data, err := json.MarshalIndent(h.builds, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(h.dir, historyIndexFile), data, 0644)
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0755)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, in)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// gitCommit returns the short hash of the current commit, with a suffix if there are uncommitted changes
+func (r *Manager) gitCommit() string {
+	out, err := exec.CommandContext(r.context, "git", "-C", r.AppRoot, "rev-parse", "--short", "HEAD").Output()
+	if err != nil {
+		return ""
+	}
+	commit := strings.TrimSpace(string(out))
+
+	out, err = exec.CommandContext(r.context, "git", "-C", r.AppRoot, "status", "--porcelain", "--untracked-files=no").Output()
+	if err == nil && len(bytes.TrimSpace(out)) > 0 {
+		commit += "-dirty"
+	}
+	return commit
+}
+
+// recordBuild adds the current binary to the build history
+func (r *Manager) recordBuild(event WatchEvent, duration time.Duration) {
+	if r.history == nil {
+		return
+	}
+
+	b, err := r.history.add(r.FullBuildPath(), Build{
+		TriggerPath:  event.Path,
+		TriggerEvent: event.Type,
+		Commit:       r.gitCommit(),
+		Time:         time.Now(),
+		Duration:     duration,
+	})
+	// The fresh binary is run also if it could not be added to the history
+	r.activeMx.Lock()
+	r.activeBuild = b
+	r.activeBinary = ""
+	r.activeMx.Unlock()
+
+	if err != nil {
+		r.logger().WithError(err).Warn("Failed to record build")
+		return
+	}
+
+	r.logger().
+		WithField("build", b.ID).
+		WithField("commit", b.Commit).
+		Debug("Recorded build")
+}
+
+// Builds returns the builds in the history, newest first
+func (r *Manager) Builds() []Build {
+	if r.history == nil {
+		return nil
+	}
+	return r.history.list()
+}
+
+// Rollback restarts the app on the build before the currently running build
+func (r *Manager) Rollback() error {
+	if r.history == nil {
+		return fmt.Errorf("build history is not enabled")
+	}
+
+	r.activeMx.Lock()
+	current := r.activeBuild.ID
+	r.activeMx.Unlock()
+
+	b, ok := r.history.previous(current)
+	if !ok {
+		return fmt.Errorf("no build before build %d", current)
+	}
+	return r.restartBuild(b)
+}
+
+// RestartBuild restarts the app on the build with the given ID from the history
+func (r *Manager) RestartBuild(id int) error {
+	if r.history == nil {
+		return fmt.Errorf("build history is not enabled")
+	}
+
+	b, ok := r.history.get(id)
+	if !ok {
+		return fmt.Errorf("build %d not found", id)
+	}
+	return r.restartBuild(b)
+}
+
+func (r *Manager) restartBuild(b Build) error {
+	r.activeMx.Lock()
+	r.activeBuild = b
+	r.activeBinary = b.Path
+	r.activeMx.Unlock()
+
+	r.setRestartCause(b.ID, []WatchEvent{{Path: b.TriggerPath, Type: "rollback"}}, 0)
+
+	r.logger().
+		WithField("build", b.ID).
+		WithField("commit", b.Commit).
+		WithField("trigger", b.TriggerPath).
+		WithField("time", b.Time.Format(time.Kitchen)).
+		Info("Restarting on previous build")
+
+	return r.requestRestart()
+}
+
+// binaryPath returns the path of the binary to run, which is a binary from the history after a rollback
+func (r *Manager) binaryPath() string {
+	r.activeMx.Lock()
+	defer r.activeMx.Unlock()
+
+	if r.activeBinary != "" {
+		return r.activeBinary
+	}
+	return r.FullBuildPath()
+}
@@ -0,0 +1,166 @@
+package refresh
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBuildHistory_add(t *testing.T) {
+	dir := t.TempDir()
+	binary := filepath.Join(dir, "app")
+	h, err := newBuildHistory(filepath.Join(dir, "app-history"), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, content := range []string{"one", "two", "three"} {
+		writeFile(t, binary, content)
+		if _, err := h.add(binary, Build{TriggerPath: content}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	builds := h.list()
+	if len(builds) != 2 || builds[0].ID != 3 || builds[1].ID != 2 {
+		t.Fatalf("list() = %+v, want builds 3 and 2", builds)
+	}
+	data, err := os.ReadFile(builds[0].Path)
+	if err != nil || string(data) != "three" {
+		t.Errorf("binary of build 3 = %q, %v", data, err)
+	}
+	// The oldest build exceeding the maximum is removed
+	if _, err := os.Stat(filepath.Join(dir, "app-history", "1")); !os.IsNotExist(err) {
+		t.Errorf("binary of build 1 was not removed: %v", err)
+	}
+	if _, ok := h.get(1); ok {
+		t.Error("get(1) found a pruned build")
+	}
+
+	if b, ok := h.previous(3); !ok || b.ID != 2 {
+		t.Errorf("previous(3) = %d, %v, want 2", b.ID, ok)
+	}
+	if _, ok := h.previous(2); ok {
+		t.Error("previous(2) found a pruned build")
+	}
+}
+
+func TestNewBuildHistory_clean(t *testing.T) {
+	dir := t.TempDir()
+	binary := filepath.Join(dir, "app")
+	writeFile(t, binary, "one")
+	historyDir := filepath.Join(dir, "app-history")
+
+	h, err := newBuildHistory(historyDir, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := h.add(binary, Build{}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Files of the previous run are removed on start
+	if _, err := newBuildHistory(historyDir, 3); err != nil {
+		t.Fatal(err)
+	}
+	entries, _ := os.ReadDir(historyDir)
+	if len(entries) != 0 {
+		t.Errorf("history contains %d files after start, want 0", len(entries))
+	}
+
+	// A directory with other files is never cleaned
+	writeFile(t, filepath.Join(historyDir, "notes.txt"), "keep")
+	_, err = newBuildHistory(historyDir, 3)
+	if err == nil || !strings.Contains(err.Error(), "notes.txt") {
+		t.Errorf("newBuildHistory() error = %v, want error for notes.txt", err)
+	}
+	if _, err := os.Stat(filepath.Join(historyDir, "notes.txt")); err != nil {
+		t.Errorf("other file was removed: %v", err)
+	}
+}
+
+func TestManager_Rollback(t *testing.T) {
+	dir := t.TempDir()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	r := NewWithContext(&Configuration{BuildPath: dir, BinaryName: "app"}, ctx)
+	r.Restart = make(chan bool, 1)
+	var err error
+	r.history, err = newBuildHistory(filepath.Join(dir, "app-history"), 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := r.Rollback(); err == nil {
+		t.Error("Rollback() without previous build should fail")
+	}
+
+	for _, content := range []string{"one", "two"} {
+		writeFile(t, r.FullBuildPath(), content)
+		r.recordBuild(WatchEvent{Path: content}, 0)
+	}
+
+	if err := r.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-r.Restart:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Rollback() did not restart the app")
+	}
+
+	if got := r.activeBuildID(); got != 1 {
+		t.Errorf("active build = %d, want 1", got)
+	}
+	data, err := os.ReadFile(r.binaryPath())
+	if err != nil || string(data) != "one" {
+		t.Errorf("binary after rollback = %q, %v, want one", data, err)
+	}
+
+	if err := r.Rollback(); err == nil {
+		t.Error("Rollback() before the first build should fail")
+	}
+}
+
+func TestManager_recordBuild_addFails(t *testing.T) {
+	dir := t.TempDir()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	r := NewWithContext(&Configuration{BuildPath: dir, BinaryName: "app"}, ctx)
+	r.Restart = make(chan bool, 1)
+	historyDir := filepath.Join(dir, "app-history")
+	var err error
+	r.history, err = newBuildHistory(historyDir, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, content := range []string{"one", "two"} {
+		writeFile(t, r.FullBuildPath(), content)
+		r.recordBuild(WatchEvent{Path: content}, 0)
+	}
+	if err := r.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Binaries can't be copied to the history anymore
+	if err := os.RemoveAll(historyDir); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, historyDir, "not a directory")
+
+	writeFile(t, r.FullBuildPath(), "three")
+	r.recordBuild(WatchEvent{Path: "three"}, 0)
+
+	if got := r.binaryPath(); got != r.FullBuildPath() {
+		t.Errorf("binaryPath() = %q, want the fresh binary %q", got, r.FullBuildPath())
+	}
+	if got := r.activeBuildID(); got != 3 {
+		t.Errorf("active build = %d, want 3", got)
+	}
+}
@@ -0,0 +1,244 @@
+package refresh
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/apex/log"
+)
+
+const keyboardHelp = "Shortcuts: r rebuild, R restart, b previous build, p pause/resume, c clear, i input to the app, q quit, h help"
+
+// keyEscape returns from sending input to the app to shortcuts (Ctrl-])
+const keyEscape = 0x1d
+
+// keyboard reads shortcuts from the terminal. Input for the app is sent through a pipe
+// only while it is toggled on, so key presses for shortcuts never reach the app.
+type keyboard struct {
+	managers []*Manager
+	stop     func()
+	fd       int
+	out      io.Writer
+	// stdin is the write end of the pipe the app reads its input from
+	stdin io.WriteCloser
+	// appStdin is the read end of the pipe
+	appStdin io.Closer
+
+	mu         sync.Mutex
+	forwarding bool
+	// restore switches the terminal back to line mode, it is nil while input is sent to the app
+	restore func() error
+}
+
+// startKeyboard reads keyboard shortcuts from stdin if enabled and it is a terminal.
+// The returned function restores the terminal.
+func startKeyboard(c *Configuration, managers []*Manager, stop func()) (shutdown func(), err error) {
+	if !c.KeyboardShortcuts {
+		return func() {}, nil
+	}
+	if c.Stdin != nil {
+		log.Warn("Keyboard shortcuts disabled, stdin is not read from the terminal")
+		return func() {}, nil
+	}
+
+	fd := int(os.Stdin.Fd())
+	restore, err := makeCbreak(fd)
+	if err != nil {
+		log.WithError(err).Warn("Keyboard shortcuts disabled")
+		return func() {}, nil
+	}
+
+	// The app gets the read end of a pipe as stdin, so it is inherited by every restarted process without copying
+	pr, pw, err := os.Pipe()
+	if err != nil {
+		_ = restore()
+		return nil, fmt.Errorf("creating stdin pipe: %w", err)
+	}
+	for _, m := range managers {
+		m.Stdin = pr
+	}
+
+	k := &keyboard{
+		managers: managers,
+		stop:     stop,
+		fd:       fd,
+		out:      os.Stderr,
+		stdin:    pw,
+		appStdin: pr,
+		restore:  restore,
+	}
+	if c.JSONLogs {
+		// Help and terminal output would be mixed into the JSON log entries on stderr
+		k.out = io.Discard
+	}
+	go k.read()
+
+	k.printHelp()
+
+	return k.close, nil
+}
+
+// close restores the terminal and closes the stdin of the app
+func (k *keyboard) close() {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.restore != nil {
+		_ = k.restore()
+		k.restore = nil
+	}
+	_ = k.stdin.Close()
+	_ = k.appStdin.Close()
+}
+
+func (k *keyboard) read() {
+	buf := make([]byte, 256)
+	for {
+		n, err := os.Stdin.Read(buf)
+		if err != nil {
+			return
+		}
+		k.handle(buf[:n])
+	}
+}
+
+// handle runs the shortcuts of the input, the input after i is sent to the app
+func (k *keyboard) handle(b []byte) {
+	for len(b) > 0 {
+		k.mu.Lock()
+		forwarding := k.forwarding
+		k.mu.Unlock()
+
+		if forwarding {
+			input, escaped := forwardedInput(b)
+			_, _ = k.stdin.Write(input)
+			if escaped {
+				k.setForwarding(false)
+			}
+			return
+		}
+
+		k.run(shortcut(b[0]))
+		b = b[1:]
+	}
+}
+
+// Commands of keyboard shortcuts
+type keyCommand int
+
+const (
+	keyNone keyCommand = iota
+	keyRebuild
+	keyRestart
+	keyRollback
+	keyTogglePause
+	keyClear
+	keyInput
+	keyQuit
+	keyHelp
+	keyNewline
+)
+
+// shortcut returns the command of the key
+func shortcut(key byte) keyCommand {
+	switch key {
+	case 'r':
+		return keyRebuild
+	case 'R':
+		return keyRestart
+	case 'b':
+		return keyRollback
+	case 'p':
+		return keyTogglePause
+	case 'c':
+		return keyClear
+	case 'i':
+		return keyInput
+	case 'q':
+		return keyQuit
+	case 'h', '?':
+		return keyHelp
+	case '\n':
+		return keyNewline
+	}
+	return keyNone
+}
+
+// forwardedInput returns the input for the app up to the escape key and if it was escaped.
+// The rest of the line with the escape is dropped.
+func forwardedInput(b []byte) (input []byte, escaped bool) {
+	i := bytes.IndexByte(b, keyEscape)
+	if i == -1 {
+		return b, false
+	}
+	return b[:i], true
+}
+
+func (k *keyboard) run(cmd keyCommand) {
+	switch cmd {
+	case keyRebuild:
+		for _, m := range k.managers {
+			m.TriggerBuild("keyboard")
+		}
+	case keyRestart:
+		for _, m := range k.managers {
+			_ = m.TriggerRestart("keyboard")
+		}
+	case keyRollback:
+		for _, m := range k.managers {
+			err := m.Rollback()
+			if err != nil {
+				m.logger().WithError(err).Warn("Rollback failed")
+			}
+		}
+	case keyTogglePause:
+		togglePause(k.managers)
+	case keyClear:
+		fmt.Fprint(k.out, "\033[H\033[2J")
+	case keyInput:
+		k.setForwarding(true)
+	case keyQuit:
+		log.Info("Quitting")
+		k.stop()
+	case keyHelp:
+		k.printHelp()
+	case keyNewline:
+		// Allow empty lines for separating output
+		fmt.Fprintln(k.out)
+	}
+}
+
+// setForwarding toggles sending input to the app, the terminal is in line mode while input is sent
+func (k *keyboard) setForwarding(forwarding bool) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if forwarding == k.forwarding {
+		return
+	}
+
+	if forwarding {
+		if k.restore != nil {
+			_ = k.restore()
+			k.restore = nil
+		}
+		k.forwarding = true
+		fmt.Fprintln(k.out, "Sending input to the app, enter Ctrl-] to return to shortcuts")
+		return
+	}
+
+	restore, err := makeCbreak(k.fd)
+	if err != nil {
+		log.WithError(err).Warn("Failed to switch terminal to shortcuts")
+		return
+	}
+	k.restore = restore
+	k.forwarding = false
+	fmt.Fprintln(k.out, keyboardHelp)
+}
+
+func (k *keyboard) printHelp() {
+	fmt.Fprintln(k.out, keyboardHelp)
+}
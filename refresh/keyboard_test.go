@@ -0,0 +1,171 @@
+package refresh
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"strconv"
+	"testing"
+)
+
+func TestShortcut(t *testing.T) {
+	tests := []struct {
+		key  byte
+		want keyCommand
+	}{
+		{key: 'r', want: keyRebuild},
+		{key: 'R', want: keyRestart},
+		{key: 'b', want: keyRollback},
+		{key: 'p', want: keyTogglePause},
+		{key: 'c', want: keyClear},
+		{key: 'i', want: keyInput},
+		{key: 'q', want: keyQuit},
+		{key: 'h', want: keyHelp},
+		{key: '?', want: keyHelp},
+		{key: '\n', want: keyNewline},
+		{key: 'x', want: keyNone},
+		{key: keyEscape, want: keyNone},
+	}
+
+	for _, tt := range tests {
+		t.Run(strconv.QuoteRune(rune(tt.key)), func(t *testing.T) {
+			if got := shortcut(tt.key); got != tt.want {
+				t.Errorf("shortcut(%q) = %v, want %v", tt.key, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestForwardedInput(t *testing.T) {
+	tests := []struct {
+		name        string
+		in          string
+		wantInput   string
+		wantEscaped bool
+	}{
+		{name: "line", in: "hello\n", wantInput: "hello\n"},
+		{name: "shortcut keys are sent to the app", in: "q\n", wantInput: "q\n"},
+		{name: "escape", in: "\x1d\n", wantInput: "", wantEscaped: true},
+		{name: "input before escape", in: "yes\x1d\n", wantInput: "yes", wantEscaped: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input, escaped := forwardedInput([]byte(tt.in))
+			if string(input) != tt.wantInput || escaped != tt.wantEscaped {
+				t.Errorf("forwardedInput(%q) = %q, %v, want %q, %v", tt.in, input, escaped, tt.wantInput, tt.wantEscaped)
+			}
+		})
+	}
+}
+
+func TestKeyboard_quitRestoresTerminal(t *testing.T) {
+	k, restored := testKeyboard(t)
+	// The terminal is restored when refresh stops after quitting
+	k.stop = k.close
+
+	k.handle([]byte("q"))
+	if *restored != 1 {
+		t.Errorf("terminal restored %d times, want 1", *restored)
+	}
+
+	k.close()
+	if *restored != 1 {
+		t.Errorf("terminal restored %d times after closing again, want 1", *restored)
+	}
+}
+
+func TestKeyboard_inputToApp(t *testing.T) {
+	tests := []struct {
+		name  string
+		reads []string
+	}{
+		{name: "separate reads", reads: []string{"i", "q\n"}},
+		// The input after i in the same read must not run shortcuts
+		{name: "single read", reads: []string{"iq\n"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k, restored := testKeyboard(t)
+			quit := false
+			k.stop = func() { quit = true }
+			app := k.appStdin.(io.Reader)
+
+			for _, b := range tt.reads {
+				k.handle([]byte(b))
+			}
+			// The terminal is in line mode while input is sent to the app
+			if *restored != 1 {
+				t.Fatalf("terminal restored %d times, want 1", *restored)
+			}
+			if quit {
+				t.Error("input to the app quit refresh")
+			}
+
+			buf := make([]byte, 10)
+			n, err := app.Read(buf)
+			if err != nil || string(buf[:n]) != "q\n" {
+				t.Errorf("app read %q, %v, want q", buf[:n], err)
+			}
+
+			// The terminal is not switched back again on stop
+			k.close()
+			if *restored != 1 {
+				t.Errorf("terminal restored %d times, want 1", *restored)
+			}
+		})
+	}
+}
+
+func TestKeyboard_togglePause(t *testing.T) {
+	k, _ := testKeyboard(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c := &Configuration{}
+	k.managers = []*Manager{NewWithContext(c, ctx), NewWithContext(c, ctx)}
+	k.managers[1].Pause()
+
+	// Services are resumed together if any is paused
+	k.handle([]byte("p"))
+	for i, m := range k.managers {
+		if m.Paused() {
+			t.Errorf("service %d still paused", i)
+		}
+	}
+
+	k.handle([]byte("p"))
+	for i, m := range k.managers {
+		if !m.Paused() {
+			t.Errorf("service %d not paused", i)
+		}
+	}
+}
+
+// testKeyboard returns a keyboard in shortcut mode with a pipe as stdin of the app, restored counts terminal restores
+func testKeyboard(t *testing.T) (k *keyboard, restored *int) {
+	t.Helper()
+	pr, pw, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		pr.Close()
+		pw.Close()
+	})
+
+	restored = new(int)
+	k = &keyboard{
+		stop:     func() {},
+		fd:       -1,
+		out:      &bytes.Buffer{},
+		stdin:    pw,
+		appStdin: pr,
+		restore: func() error {
+			*restored++
+			return nil
+		},
+	}
+	return k, restored
+}
@@ -0,0 +1,18 @@
+package refresh
+
+// LifecycleField is the log field with the name of a lifecycle event. It is meant for machine-readable
+// log output and is not printed by the text log handler.
+const LifecycleField = "lifecycle"
+
+// DiagnosticsField is the log field with the diagnostics of a failed build. It is not printed by the text
+// log handler, a summary of the diagnostics is printed instead.
+const DiagnosticsField = "diagnostics"
+
+// Lifecycle events of builds and processes, their names are stable
+const (
+	LifecycleBuildStart   = "build_start"
+	LifecycleBuildOK      = "build_ok"
+	LifecycleBuildFailed  = "build_failed"
+	LifecycleProcessStart = "process_start"
+	LifecycleProcessExit  = "process_exit"
+)
@@ -0,0 +1,560 @@
+package refresh
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/r3labs/sse/v2"
+	"github.com/rs/cors"
+	"gopkg.in/cenkalti/backoff.v1"
+
+	"github.com/networkteam/refresh/static"
+)
+
+const (
+	refreshRestartEventName     = "refresh-restart"
+	refreshBuildFailedEventName = "refresh-build-failed"
+	refreshCrashedEventName     = "refresh-crashed"
+	refreshAssetEventName       = "refresh-asset"
+)
+
+// defaultEditorURL opens files from the error overlay in VS Code
+const defaultEditorURL = "vscode://file{file}:{line}:{column}"
+
+// crashOutputLines is the number of lines of stderr sent to live reload clients if a process crashed
+const crashOutputLines = 30
+
+type buildFailedPayload struct {
+	Service     string                 `json:"service,omitempty"`
+	Diagnostics []liveReloadDiagnostic `json:"diagnostics"`
+	Output      string                 `json:"output,omitempty"`
+}
+
+type liveReloadDiagnostic struct {
+	Diagnostic
+	URL string `json:"url,omitempty"`
+}
+
+type assetPayload struct {
+	// Path of the changed file relative to the app root, with forward slashes
+	Path string `json:"path"`
+	Type string `json:"type"`
+}
+
+// restartPayloadVersion is incremented on incompatible changes of restartPayload
+const restartPayloadVersion = 1
+
+// restartPayload is the data of a restart event
+type restartPayload struct {
+	Version int    `json:"version"`
+	Service string `json:"service,omitempty"`
+	BuildID int    `json:"buildId,omitempty"`
+	// TriggerPath is relative to the app root, with forward slashes like ChangedFiles
+	TriggerPath  string   `json:"triggerPath,omitempty"`
+	TriggerEvent string   `json:"triggerEvent,omitempty"`
+	DurationMs   int64    `json:"durationMs"`
+	BinaryHash   string   `json:"binaryHash,omitempty"`
+	ChangedFiles []string `json:"changedFiles"`
+	URLs         []string `json:"urls,omitempty"`
+	Message      string   `json:"message"`
+	// Missed is set if a reconnecting client missed events, so it should reload
+	Missed bool      `json:"missed,omitempty"`
+	Time   time.Time `json:"time"`
+}
+
+// restartCause is the build and the changes that caused a restart
+type restartCause struct {
+	buildID  int
+	events   []WatchEvent
+	duration time.Duration
+	hash     string
+}
+
+type crashedPayload struct {
+	Service string `json:"service,omitempty"`
+	Process string `json:"process,omitempty"`
+	Error   string `json:"error"`
+	Output  string `json:"output,omitempty"`
+}
+
+// defaultLiveReloadAddr binds the live reload server to a random port on the loopback interface
+const defaultLiveReloadAddr = "127.0.0.1:0"
+
+// liveReloadShutdownTimeout is the time to wait for open requests when the live reload server is stopped
+const liveReloadShutdownTimeout = 5 * time.Second
+
+// liveReloadServer sends SSE events to clients when the app was restarted.
+// It can be shared by the managers of multiple services.
+type liveReloadServer struct {
+	sse    *sse.Server
+	ws     *wsHub
+	replay *replayBuffer
+	srv    *http.Server
+	// url is the advertised base URL of the server
+	url       string
+	hasAssets bool
+	// allowOrigin checks if a page of the origin may receive events
+	allowOrigin func(origin string) bool
+}
+
+// newLiveReloadServer starts the live reload server on the configured address, it also serves the static asset directories
+func newLiveReloadServer(ctx context.Context, c *Configuration) (*liveReloadServer, error) {
+	assetDirs := c.assetDirs()
+	s := &liveReloadServer{
+		hasAssets:   len(assetDirs) > 0,
+		allowOrigin: allowedOrigins(c),
+	}
+
+	s.sse = sse.New()
+	s.sse.AutoReplay = false
+	s.sse.CreateStream("refresh")
+
+	s.replay = newReplayBuffer(replayBufferSize)
+	s.ws = newWSHub(s.replay, s.allowOrigin)
+
+	// Start HTTP server with CORS for the pages of the app in the background
+
+	corsMiddleware := cors.New(cors.Options{
+		AllowOriginFunc: s.allowOrigin,
+		AllowedMethods: []string{
+			http.MethodHead,
+			http.MethodGet,
+			http.MethodPost,
+			http.MethodPut,
+			http.MethodPatch,
+			http.MethodDelete,
+		},
+		AllowedHeaders: []string{"*"},
+	})
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/events", s.serveSSE)
+	mux.Handle("/ws", s.ws.handler())
+	mux.HandleFunc("/static/reload.js", func(w http.ResponseWriter, r *http.Request) {
+		file, err := static.Files.ReadFile("reload.js")
+		if err != nil {
+			log.WithError(err).Error("liveReload: Failed to read reload.js")
+			http.Error(w, "Failed to load reload.js", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/javascript")
+		file = bytes.Replace(file, []byte("${REFRESH_LIVE_RELOAD_SSE_URL}"), []byte(s.sseURL()), 1)
+		file = bytes.Replace(file, []byte("${REFRESH_LIVE_RELOAD_WS_URL}"), []byte(s.wsURL()), 1)
+		_, _ = w.Write(file)
+	})
+
+	if s.hasAssets {
+		mux.Handle(liveReloadAssetsPath, http.StripPrefix(liveReloadAssetsPath, assetHandler{dirs: assetDirs}))
+	}
+
+	addr := c.LiveReloadAddr
+	if addr == "" {
+		addr = defaultLiveReloadAddr
+	}
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("starting live reload server on %s: %w", addr, err)
+	}
+
+	tlsConfig, err := c.liveReloadTLS(l.Addr().(*net.TCPAddr))
+	if err != nil {
+		l.Close()
+		return nil, err
+	}
+
+	s.url = strings.TrimSuffix(c.LiveReloadURL, "/")
+	if s.url == "" {
+		scheme := "http://"
+		if tlsConfig != nil {
+			scheme = "https://"
+		}
+		s.url = scheme + advertisedAddr(l.Addr().(*net.TCPAddr))
+	}
+
+	s.srv = &http.Server{
+		Handler:   corsMiddleware.Handler(mux),
+		TLSConfig: tlsConfig,
+	}
+	go func() {
+		var err error
+		if tlsConfig != nil {
+			err = s.srv.ServeTLS(l, "", "")
+		} else {
+			err = s.srv.Serve(l)
+		}
+		if err != nil && err != http.ErrServerClosed {
+			log.WithError(err).Error("liveReload: Server failed")
+		}
+	}()
+
+	log.
+		WithField("addr", l.Addr().String()).
+		Debugf("liveReload: Started server on %s", s.url)
+
+	// Close the SSE streams and shut down the server when the context is done
+	go func() {
+		<-ctx.Done()
+		s.sse.Close()
+		s.ws.close()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), liveReloadShutdownTimeout)
+		defer cancel()
+		if err := s.srv.Shutdown(shutdownCtx); err != nil {
+			log.WithError(err).Warn("liveReload: Failed to shut down server")
+		}
+		log.Debug("liveReload: Stopped server")
+	}()
+
+	return s, nil
+}
+
+// allowedOrigins returns a check for the origin of pages requesting events. Events contain build errors and the
+// output of the app, so only pages on a loopback host, the host of live_reload_url or in live_reload_origins get them.
+func allowedOrigins(c *Configuration) func(origin string) bool {
+	hosts := map[string]bool{"localhost": true}
+	if u, err := url.Parse(c.LiveReloadURL); err == nil && u.Hostname() != "" {
+		hosts[strings.ToLower(u.Hostname())] = true
+	}
+	origins := make(map[string]bool, len(c.LiveReloadOrigins))
+	for _, o := range c.LiveReloadOrigins {
+		origins[strings.ToLower(strings.TrimSuffix(o, "/"))] = true
+	}
+
+	return func(origin string) bool {
+		if origins[strings.ToLower(origin)] {
+			return true
+		}
+		u, err := url.Parse(origin)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return false
+		}
+		host := strings.ToLower(u.Hostname())
+		if hosts[host] || strings.HasSuffix(host, ".localhost") {
+			return true
+		}
+		ip := net.ParseIP(host)
+		return ip != nil && ip.IsLoopback()
+	}
+}
+
+// advertisedAddr returns the address of the listener for URLs, an unspecified IP is replaced by localhost
+func advertisedAddr(addr *net.TCPAddr) string {
+	host := addr.IP.String()
+	if addr.IP == nil || addr.IP.IsUnspecified() {
+		host = "localhost"
+	}
+	return net.JoinHostPort(host, strconv.Itoa(addr.Port))
+}
+
+func (s *liveReloadServer) sseURL() string {
+	return s.url + "/events?stream=refresh"
+}
+
+func (s *liveReloadServer) wsURL() string {
+	return wsURL(s.url) + "/ws"
+}
+
+// env returns the environment variables that pass the SSE and WebSocket URLs, event type and assets URL to the process
+func (s *liveReloadServer) env() []string {
+	env := []string{
+		"REFRESH_LIVE_RELOAD_SSE_URL=" + s.sseURL(),
+		"REFRESH_LIVE_RELOAD_SSE_EVENT=" + refreshRestartEventName,
+		"REFRESH_LIVE_RELOAD_WS_URL=" + s.wsURL(),
+		"REFRESH_LIVE_RELOAD_SCRIPT_URL=" + s.url + "/static/reload.js",
+	}
+	if s.hasAssets {
+		env = append(env, "REFRESH_LIVE_RELOAD_ASSETS_URL="+s.url+strings.TrimSuffix(liveReloadAssetsPath, "/"))
+	}
+	return env
+}
+
+// serveSSE serves the SSE stream, the events a reconnecting client missed are replayed first
+func (s *liveReloadServer) serveSSE(w http.ResponseWriter, r *http.Request) {
+	if origin := r.Header.Get("Origin"); origin != "" && !s.allowOrigin(origin) {
+		http.Error(w, "Origin not allowed", http.StatusForbidden)
+		return
+	}
+
+	lastID := lastEventID(r)
+	// The SSE server must not replay events by itself
+	r.Header.Del("Last-Event-ID")
+
+	if lastID != "" {
+		w = &replayWriter{ResponseWriter: w, replay: s.replay, lastID: lastID}
+	}
+
+	s.sse.ServeHTTP(w, r)
+}
+
+// publish sends the event to all SSE and WebSocket clients
+func (s *liveReloadServer) publish(event string, data []byte) {
+	id := s.replay.add(event, data)
+	s.sse.Publish("refresh", &sse.Event{
+		ID:    []byte(id),
+		Event: []byte(event),
+		Data:  data,
+	})
+	s.ws.broadcast(id, event, data)
+}
+
+// publishAsset sends a changed stylesheet or image to clients, so they can swap it without reloading the page
+func (s *liveReloadServer) publishAsset(appRoot string, event WatchEvent) {
+	appPath, _ := filepath.Abs(appRoot)
+	path := relativePath(appPath, event.Path)
+
+	data, err := json.Marshal(assetPayload{
+		Path: filepath.ToSlash(path),
+		Type: event.Asset,
+	})
+	if err != nil {
+		log.WithError(err).Error("liveReload: Failed to encode event")
+		return
+	}
+
+	log.WithField("path", path).Debugf("liveReload: Notify %s", refreshAssetEventName)
+
+	s.publish(refreshAssetEventName, data)
+}
+
+func (r *Manager) startLiveReloadServer() error {
+	if !r.LiveReload {
+		return nil
+	}
+
+	// The server might already be set up by a supervisor for multiple services
+	if r.liveReload == nil {
+		var err error
+		r.liveReload, err = newLiveReloadServer(r.context, r.Configuration)
+		if err != nil {
+			return err
+		}
+	}
+
+	r.CommandEnv = append(r.CommandEnv, r.liveReload.env()...)
+	return nil
+}
+
+func (r *Manager) notifyLiveReloadRestart() {
+	if r.liveReload == nil {
+		return
+	}
+
+	var appURLs []string
+	for _, p := range r.processes {
+		if p.readynessURL != "" {
+			err := r.waitForReadyness(p.readynessURL, p.readyOnAnyStatus)
+			if err != nil {
+				r.logger().WithError(err).Warn("liveReload: Readyness check failed")
+				return
+			}
+		}
+		if p.appURL != "" {
+			appURLs = append(appURLs, p.appURL)
+		}
+	}
+
+	message := "The server has been restarted"
+	if r.Name != "" {
+		message = "The service " + r.Name + " has been restarted"
+	}
+	if len(appURLs) > 0 {
+		message += " on " + strings.Join(appURLs, ", ")
+	}
+
+	r.restartMx.Lock()
+	cause := r.restartCause
+	r.restartMx.Unlock()
+
+	payload := restartPayload{
+		Version:      restartPayloadVersion,
+		Service:      r.Name,
+		BuildID:      cause.buildID,
+		DurationMs:   cause.duration.Milliseconds(),
+		BinaryHash:   cause.hash,
+		ChangedFiles: []string{},
+		URLs:         appURLs,
+		Message:      message,
+		Time:         time.Now(),
+	}
+	appPath, _ := filepath.Abs(r.AppRoot)
+	for i, e := range cause.events {
+		if i == 0 {
+			payload.TriggerPath = filepath.ToSlash(relativePath(appPath, e.Path))
+			payload.TriggerEvent = e.Type
+		}
+		// Builds on start and manual triggers have no changed file
+		if e.Path == r.AppRoot || e.Type == "rollback" {
+			continue
+		}
+		payload.ChangedFiles = append(payload.ChangedFiles, filepath.ToSlash(relativePath(appPath, e.Path)))
+	}
+
+	r.publishLiveReload(refreshRestartEventName, payload)
+}
+
+// setRestartCause sets the build and the changes that are sent to live reload clients on the next restart
+func (r *Manager) setRestartCause(buildID int, events []WatchEvent, duration time.Duration) {
+	r.activeMx.Lock()
+	hash := r.binaryHash
+	activeBinary := r.activeBinary
+	r.activeMx.Unlock()
+	// The hash of the last build does not match a binary from the build history
+	if activeBinary != "" {
+		hash, _ = binaryHash(activeBinary)
+	}
+
+	r.restartMx.Lock()
+	defer r.restartMx.Unlock()
+	r.restartCause = restartCause{
+		buildID:  buildID,
+		events:   events,
+		duration: duration,
+		hash:     hex.EncodeToString(hash[:]),
+	}
+}
+
+// nextBuildID returns the ID of a new build, it matches the ID in the build history if enabled
+func (r *Manager) nextBuildID() int {
+	if id := r.activeBuildID(); r.history != nil && id != 0 {
+		return id
+	}
+	r.restartMx.Lock()
+	defer r.restartMx.Unlock()
+	r.buildSeq++
+	return r.buildSeq
+}
+
+func (r *Manager) activeBuildID() int {
+	if r.history == nil {
+		r.restartMx.Lock()
+		defer r.restartMx.Unlock()
+		return r.buildSeq
+	}
+	r.activeMx.Lock()
+	defer r.activeMx.Unlock()
+	return r.activeBuild.ID
+}
+
+// waitForReadyness checks the URL until it responds with status 200 or any status if anyStatus is set
+func (r *Manager) waitForReadyness(readynessURL string, anyStatus bool) error {
+	r.logger().WithField("url", readynessURL).Debug("liveReload: Waiting for readyness")
+
+	// TODO Check what happens if app never becomes ready?
+
+	return backoff.Retry(func() error {
+		// Check if r.context is done
+		select {
+		case <-r.context.Done():
+			return backoff.Permanent(r.context.Err())
+		default:
+		}
+
+		resp, err := http.Get(readynessURL)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode != 200 && !anyStatus {
+			return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+		}
+
+		r.logger().Debug("liveReload: Readyness check successful")
+		return nil
+	}, backoff.NewExponentialBackOff())
+}
+
+// notifyLiveReloadBuildFailed sends the diagnostics of a failed build to live reload clients for showing an error overlay
+func (r *Manager) notifyLiveReloadBuildFailed(err error) {
+	if r.liveReload == nil {
+		return
+	}
+
+	payload := buildFailedPayload{
+		Service:     r.Name,
+		Diagnostics: []liveReloadDiagnostic{},
+	}
+	var buildErr *BuildError
+	if errors.As(err, &buildErr) && len(buildErr.Diagnostics) > 0 {
+		for _, d := range buildErr.Diagnostics {
+			payload.Diagnostics = append(payload.Diagnostics, liveReloadDiagnostic{
+				Diagnostic: d,
+				URL:        r.editorURL(d),
+			})
+		}
+	} else {
+		payload.Output = err.Error()
+	}
+
+	r.publishLiveReload(refreshBuildFailedEventName, payload)
+}
+
+// notifyLiveReloadCrash sends the error and the last lines of stderr of a crashed process to live reload clients
+func (r *Manager) notifyLiveReloadCrash(p *process, err error, stderr string) {
+	if r.liveReload == nil {
+		return
+	}
+
+	lines := strings.Split(strings.TrimRight(stderr, "\n"), "\n")
+	if len(lines) > crashOutputLines {
+		lines = lines[len(lines)-crashOutputLines:]
+	}
+
+	r.publishLiveReload(refreshCrashedEventName, crashedPayload{
+		Service: r.Name,
+		Process: p.Name,
+		Error:   strings.SplitN(err.Error(), "\n", 2)[0],
+		Output:  strings.Join(lines, "\n"),
+	})
+}
+
+func (r *Manager) publishLiveReload(event string, payload interface{}) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		r.logger().WithError(err).Error("liveReload: Failed to encode event")
+		return
+	}
+
+	r.logger().Debugf("liveReload: Notify %s", event)
+
+	r.liveReload.publish(event, data)
+}
+
+// editorURL returns a link for opening the file of the diagnostic in an editor
+func (r *Manager) editorURL(d Diagnostic) string {
+	tmpl := r.EditorURL
+	if tmpl == "" {
+		tmpl = defaultEditorURL
+	}
+
+	file := d.File
+	if !filepath.IsAbs(file) {
+		file = filepath.Join(r.AppRoot, file)
+	}
+	if abs, err := filepath.Abs(file); err == nil {
+		file = abs
+	}
+
+	// The file is always passed as an absolute path with a leading slash, also on Windows
+	file = filepath.ToSlash(file)
+	if !strings.HasPrefix(file, "/") {
+		file = "/" + file
+	}
+
+	return strings.NewReplacer(
+		"{file}", file,
+		"{line}", strconv.Itoa(d.Line),
+		"{column}", strconv.Itoa(d.Column),
+	).Replace(tmpl)
+}
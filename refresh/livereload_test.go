@@ -0,0 +1,348 @@
+package refresh
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAdvertisedAddr(t *testing.T) {
+	tests := []struct {
+		name string
+		addr *net.TCPAddr
+		want string
+	}{
+		{name: "loopback", addr: &net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 35729}, want: "127.0.0.1:35729"},
+		{name: "unspecified IPv4", addr: &net.TCPAddr{IP: net.IPv4zero, Port: 35729}, want: "localhost:35729"},
+		{name: "unspecified IPv6", addr: &net.TCPAddr{IP: net.IPv6unspecified, Port: 35729}, want: "localhost:35729"},
+		{name: "IPv6", addr: &net.TCPAddr{IP: net.ParseIP("::1"), Port: 35729}, want: "[::1]:35729"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := advertisedAddr(tt.addr); got != tt.want {
+				t.Errorf("advertisedAddr() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewLiveReloadServer_url(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	s, err := newLiveReloadServer(ctx, &Configuration{
+		LiveReload:     true,
+		LiveReloadAddr: "127.0.0.1:0",
+		LiveReloadURL:  "http://devbox.local:35729/",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantSSE := "REFRESH_LIVE_RELOAD_SSE_URL=http://devbox.local:35729/events?stream=refresh"
+	if env := s.env(); env[0] != wantSSE {
+		t.Errorf("env()[0] = %q, want %q", env[0], wantSSE)
+	}
+}
+
+func TestManager_notifyLiveReloadRestart(t *testing.T) {
+	dir := t.TempDir()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	r := NewWithContext(&Configuration{AppRoot: dir, BuildPath: dir, BinaryName: "app", LiveReload: true}, ctx)
+	if err := r.startLiveReloadServer(); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, r.FullBuildPath(), "binary")
+	hash, err := binaryHash(r.FullBuildPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.binaryHash = hash
+
+	r.setRestartCause(r.nextBuildID(), []WatchEvent{
+		{Path: filepath.Join(dir, "handler", "index.go"), Type: "notify.Write"},
+		{Path: filepath.Join(dir, "main.go"), Type: "notify.Write"},
+	}, 1500*time.Millisecond)
+	r.notifyLiveReloadRestart()
+
+	events := r.liveReload.replay.events
+	if len(events) != 1 || events[0].event != refreshRestartEventName {
+		t.Fatalf("published events = %v, want one restart event", events)
+	}
+	var payload restartPayload
+	if err := json.Unmarshal(events[0].data, &payload); err != nil {
+		t.Fatal(err)
+	}
+
+	if payload.Version != restartPayloadVersion || payload.BuildID != 1 || payload.DurationMs != 1500 {
+		t.Errorf("payload = %+v, want version %d, build 1 and duration 1500ms", payload, restartPayloadVersion)
+	}
+	if payload.TriggerPath != "handler/index.go" || payload.TriggerEvent != "notify.Write" {
+		t.Errorf("trigger = %s %s, want the first event", payload.TriggerEvent, payload.TriggerPath)
+	}
+	if want := []string{"handler/index.go", "main.go"}; !reflect.DeepEqual(payload.ChangedFiles, want) {
+		t.Errorf("changed files = %v, want %v", payload.ChangedFiles, want)
+	}
+	if payload.BinaryHash != hex.EncodeToString(hash[:]) {
+		t.Errorf("binary hash = %s, want %x", payload.BinaryHash, hash)
+	}
+}
+
+func TestAllowedOrigins(t *testing.T) {
+	allowed := allowedOrigins(&Configuration{
+		LiveReloadURL:     "http://devbox.local:35729",
+		LiveReloadOrigins: []string{"https://app.test/"},
+	})
+
+	tests := []struct {
+		origin string
+		want   bool
+	}{
+		{origin: "http://localhost:3000", want: true},
+		{origin: "http://shop.localhost:8080", want: true},
+		{origin: "http://127.0.0.1:3000", want: true},
+		{origin: "http://[::1]:3000", want: true},
+		{origin: "http://devbox.local:3000", want: true},
+		{origin: "https://app.test", want: true},
+		{origin: "https://app.test:8443", want: false},
+		{origin: "https://example.com", want: false},
+		{origin: "http://localhost.example.com", want: false},
+		{origin: "null", want: false},
+		{origin: "file://localhost", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.origin, func(t *testing.T) {
+			if got := allowed(tt.origin); got != tt.want {
+				t.Errorf("allowedOrigins()(%q) = %v, want %v", tt.origin, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewLiveReloadServer_origin(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	s, err := newLiveReloadServer(ctx, &Configuration{LiveReload: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		origin     string
+		wantStatus int
+		wantCORS   string
+	}{
+		{origin: "https://example.com", wantStatus: http.StatusForbidden},
+		{origin: "http://localhost:3000", wantStatus: http.StatusOK, wantCORS: "http://localhost:3000"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.origin, func(t *testing.T) {
+			reqCtx, reqCancel := context.WithCancel(ctx)
+			defer reqCancel()
+
+			req, err := http.NewRequestWithContext(reqCtx, http.MethodGet, s.sseURL(), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Origin", tt.origin)
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+			if got := resp.Header.Get("Access-Control-Allow-Origin"); got != tt.wantCORS {
+				t.Errorf("Access-Control-Allow-Origin = %q, want %q", got, tt.wantCORS)
+			}
+		})
+	}
+}
+
+func TestManager_notifyLiveReloadBuildFailed(t *testing.T) {
+	dir := t.TempDir()
+
+	tests := []struct {
+		name string
+		err  error
+		want buildFailedPayload
+	}{
+		{
+			name: "diagnostics",
+			err: &BuildError{
+				Err:         errors.New("exit status 1"),
+				Diagnostics: []Diagnostic{{Package: "example.com/app", File: "main.go", Line: 9, Column: 14, Message: "undefined: x"}},
+			},
+			want: buildFailedPayload{
+				Service: "api",
+				Diagnostics: []liveReloadDiagnostic{{
+					Diagnostic: Diagnostic{Package: "example.com/app", File: "main.go", Line: 9, Column: 14, Message: "undefined: x"},
+					URL:        "vscode://file" + filepath.ToSlash(filepath.Join(dir, "main.go")) + ":9:14",
+				}},
+			},
+		},
+		{
+			name: "raw error",
+			err:  errors.New("go: cannot find main module"),
+			want: buildFailedPayload{
+				Service:     "api",
+				Diagnostics: []liveReloadDiagnostic{},
+				Output:      "go: cannot find main module",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := testLiveReloadManager(t, &Configuration{AppRoot: dir})
+			r.Name = "api"
+			r.notifyLiveReloadBuildFailed(tt.err)
+
+			var got buildFailedPayload
+			publishedPayload(t, r, refreshBuildFailedEventName, &got)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("payload = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestManager_notifyLiveReloadCrash(t *testing.T) {
+	var long []string
+	for i := 1; i <= crashOutputLines+5; i++ {
+		long = append(long, fmt.Sprintf("line %d", i))
+	}
+
+	tests := []struct {
+		name   string
+		err    error
+		stderr string
+		want   crashedPayload
+	}{
+		{
+			name:   "output",
+			err:    errors.New("exit status 2\npanic: boom"),
+			stderr: "panic: boom\n\ngoroutine 1 [running]:\n",
+			want:   crashedPayload{Service: "api", Process: "web", Error: "exit status 2", Output: "panic: boom\n\ngoroutine 1 [running]:"},
+		},
+		{
+			name:   "last lines of long output",
+			err:    errors.New("exit status 1"),
+			stderr: strings.Join(long, "\n") + "\n",
+			want:   crashedPayload{Service: "api", Process: "web", Error: "exit status 1", Output: strings.Join(long[5:], "\n")},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := testLiveReloadManager(t, &Configuration{})
+			r.Name = "api"
+			r.notifyLiveReloadCrash(&process{Process: Process{Name: "web"}}, tt.err, tt.stderr)
+
+			var got crashedPayload
+			publishedPayload(t, r, refreshCrashedEventName, &got)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("payload = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestManager_editorURL(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.ToSlash(filepath.Join(dir, "handler", "index.go"))
+	if !strings.HasPrefix(file, "/") {
+		file = "/" + file
+	}
+
+	tests := []struct {
+		name      string
+		editorURL string
+		file      string
+		want      string
+	}{
+		{name: "default", file: filepath.Join("handler", "index.go"), want: "vscode://file" + file + ":12:3"},
+		{name: "absolute file", file: filepath.Join(dir, "handler", "index.go"), want: "vscode://file" + file + ":12:3"},
+		{name: "template", editorURL: "idea://open?file={file}&line={line}", file: filepath.Join("handler", "index.go"), want: "idea://open?file=" + file + "&line=12"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &Manager{Configuration: &Configuration{AppRoot: dir, EditorURL: tt.editorURL}}
+			if got := r.editorURL(Diagnostic{File: tt.file, Line: 12, Column: 3}); got != tt.want {
+				t.Errorf("editorURL() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// testLiveReloadManager returns a manager with a started live reload server
+func testLiveReloadManager(t *testing.T, c *Configuration) *Manager {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	c.LiveReload = true
+	r := NewWithContext(c, ctx)
+	if err := r.startLiveReloadServer(); err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+// publishedPayload decodes the payload of the only published event
+func publishedPayload(t *testing.T, r *Manager, event string, payload interface{}) {
+	t.Helper()
+	events := r.liveReload.replay.events
+	if len(events) != 1 || events[0].event != event {
+		t.Fatalf("published events = %v, want one %s event", events, event)
+	}
+	if err := json.Unmarshal(events[0].data, payload); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestManager_waitForReadyness(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	defer srv.Close()
+
+	tests := []struct {
+		name      string
+		anyStatus bool
+		wantErr   bool
+	}{
+		{name: "defaulted URL is ready on any status", anyStatus: true},
+		{name: "configured URL needs status 200", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+
+			r := NewWithContext(&Configuration{}, ctx)
+			err := r.waitForReadyness(srv.URL+"/", tt.anyStatus)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("waitForReadyness() error = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,87 @@
+package refresh
+
+import (
+	"bytes"
+	"sync"
+)
+
+// logBufferSize is the number of output lines kept for the logs of the control API
+const logBufferSize = 1000
+
+// logBuffer keeps the last lines of the app output and sends new lines to subscribers
+type logBuffer struct {
+	mu      sync.Mutex
+	lines   []string
+	size    int
+	partial []byte
+	subs    map[chan string]struct{}
+}
+
+func newLogBuffer(size int) *logBuffer {
+	return &logBuffer{
+		size: size,
+		subs: make(map[chan string]struct{}),
+	}
+}
+
+func (b *logBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.partial = append(b.partial, p...)
+	for {
+		i := bytes.IndexByte(b.partial, '\n')
+		if i < 0 {
+			break
+		}
+		b.add(string(b.partial[:i]))
+		b.partial = b.partial[i+1:]
+	}
+	return len(p), nil
+}
+
+func (b *logBuffer) add(line string) {
+	if len(b.lines) >= b.size {
+		b.lines = append(b.lines[:0], b.lines[1:]...)
+	}
+	b.lines = append(b.lines, line)
+
+	for c := range b.subs {
+		select {
+		case c <- line:
+		default:
+			// Drop lines for slow subscribers instead of blocking the output of the app
+		}
+	}
+}
+
+// tail returns the last n lines, or all lines if n is not positive
+func (b *logBuffer) tail(n int) []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.tailLocked(n)
+}
+
+func (b *logBuffer) tailLocked(n int) []string {
+	lines := b.lines
+	if n > 0 && n < len(lines) {
+		lines = lines[len(lines)-n:]
+	}
+	return append([]string(nil), lines...)
+}
+
+// follow returns the last n lines and a channel with new lines until cancel is called
+func (b *logBuffer) follow(n int) (tail []string, lines <-chan string, cancel func()) {
+	c := make(chan string, 100)
+
+	b.mu.Lock()
+	tail = b.tailLocked(n)
+	b.subs[c] = struct{}{}
+	b.mu.Unlock()
+
+	return tail, c, func() {
+		b.mu.Lock()
+		delete(b.subs, c)
+		b.mu.Unlock()
+	}
+}
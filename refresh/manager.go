@@ -1,32 +1,75 @@
 package refresh
 
 import (
-	"bytes"
 	"context"
+	"crypto/md5"
+	"errors"
 	"fmt"
-	"net/http"
-	"net/http/httptest"
+	"io"
+	"os"
 	"os/exec"
+	"path/filepath"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/apex/log"
-	"github.com/r3labs/sse/v2"
-	"github.com/rs/cors"
-	"gopkg.in/cenkalti/backoff.v1"
-
-	"github.com/networkteam/refresh/static"
 )
 
 type Manager struct {
 	*Configuration
-	ID            string
+	ID string
+	// Name of the service in multi-service mode
+	Name          string
 	Restart       chan bool
 	cancelFunc    context.CancelFunc
 	context       context.Context
 	buildRequests chan WatchEvent
-
-	liveReloadSSE *sse.Server
+	processes     []*process
+
+	liveReload *liveReloadServer
+
+	// affectedOnly skips builds for changes of packages the build target does not depend on
+	affectedOnly bool
+	depsMx       sync.RWMutex
+	deps         map[string]struct{}
+
+	pendingMx sync.Mutex
+	pending   []WatchEvent
+
+	lastBuildMx sync.Mutex
+	lastBuild   *BuildResult
+
+	history      *buildHistory
+	activeMx     sync.Mutex
+	activeBuild  Build
+	activeBinary string
+	// binaryHash is the hash of the last built binary
+	binaryHash [md5.Size]byte
+
+	// restartCause describes the next restart for live reload clients
+	restartMx    sync.Mutex
+	restartCause restartCause
+	buildSeq     int
+	// restartPending is set while a restart request waits for the runner
+	restartPending atomic.Bool
+
+	stateMx  sync.Mutex
+	building bool
+	starting bool
+	paused   bool
+	// gitOperation is the marker of a git operation in progress
+	gitOperation string
+	// pausedEvents are the changes while paused or during a git operation, handled on resume
+	pausedEvents []WatchEvent
+
+	// logs keeps the output of the app for the control API
+	logs *logBuffer
+
+	// stopErr is the error the manager was stopped with, it is returned by Start
+	stopMx  sync.Mutex
+	stopErr error
 }
 
 func NewWithContext(c *Configuration, ctx context.Context) *Manager {
@@ -39,18 +82,54 @@ func NewWithContext(c *Configuration, ctx context.Context) *Manager {
 		context:       ctx,
 		// A buffered channel for build requests: there can be one scheduled build after the current build for debouncing watch changes
 		buildRequests: make(chan WatchEvent, 1),
+		affectedOnly:  c.BuildAffectedOnly,
 	}
 	return m
 }
 
 func (r *Manager) Start() error {
-	w := NewWatcher(r.context, r.AppRoot, r.IncludedExtensions, r.IncludedPatterns, r.IgnoredFolders)
+	w := newWatcher(r.context, r.Configuration)
 	err := w.Start()
 	if err != nil {
 		return err
 	}
 
-	r.startLiveReloadServer()
+	shutdownControl, err := startControlServer(r.Configuration, []*Manager{r}, r.Stop)
+	if err != nil {
+		return err
+	}
+	defer shutdownControl()
+
+	shutdownKeyboard, err := startKeyboard(r.Configuration, []*Manager{r}, r.Stop)
+	if err != nil {
+		return err
+	}
+	defer shutdownKeyboard()
+
+	watchGitOperations(r.context, r.Configuration, []*Manager{r})
+	handleSignals(r.context, []*Manager{r})
+
+	return r.run(w.Events)
+}
+
+// run builds and runs the app on requests from the given watch events until the context is done
+func (r *Manager) run(events <-chan WatchEvent) error {
+	err := r.startLiveReloadServer()
+	if err != nil {
+		return err
+	}
+
+	err = r.setupProcesses()
+	if err != nil {
+		return err
+	}
+
+	if r.BuildHistory > 0 {
+		r.history, err = newBuildHistory(filepath.Join(r.BuildPath, r.BinaryName+"-history"), r.BuildHistory)
+		if err != nil {
+			return err
+		}
+	}
 
 	// Select loop to process build requests sequentially
 	go func() {
@@ -58,9 +137,22 @@ func (r *Manager) Start() error {
 			select {
 			case event := <-r.buildRequests:
 				r.drainBuildRequests(event)
-				err := r.build(event)
+				events := r.takePendingEvents()
+				if len(events) == 0 {
+					continue
+				}
+				if !needsBuild(events) {
+					r.logger().
+						WithField("path", events[0].Path).
+						Info("Restarting...")
+					r.setRestartCause(r.activeBuildID(), events, 0)
+					r.Restart <- true
+					continue
+				}
+				err := r.build(events)
 				if err != nil {
-					log.WithError(err).Error("Build error occurred")
+					r.logBuildError(err)
+					r.notifyLiveReloadBuildFailed(err)
 				}
 			case <-r.context.Done():
 				return
@@ -76,7 +168,28 @@ func (r *Manager) Start() error {
 		go func() {
 			for {
 				select {
-				case event := <-w.Events:
+				case event := <-events:
+					if r.affectedOnly && event.Action == "" && !r.affectedBy(event) {
+						r.logger().
+							WithField("path", event.Path).
+							Debug("Ignoring change in package that is not a dependency")
+						continue
+					}
+					if r.recordPausedEvent(event) {
+						r.logger().
+							WithField("path", event.Path).
+							Debug("Recorded change while paused")
+						continue
+					}
+					if event.Action == ActionReload {
+						if event.Asset != "" && r.liveReload != nil {
+							r.liveReload.publishAsset(r.AppRoot, event)
+							continue
+						}
+						r.setRestartCause(r.activeBuildID(), []WatchEvent{event}, 0)
+						go r.notifyLiveReloadRestart()
+						continue
+					}
 					r.requestBuild(event)
 				case <-r.context.Done():
 					return
@@ -86,26 +199,95 @@ func (r *Manager) Start() error {
 	}
 
 	r.runner()
-	return nil
+
+	r.stopMx.Lock()
+	defer r.stopMx.Unlock()
+	return r.stopErr
+}
+
+// stopWithError stops the manager, Start returns the error
+func (r *Manager) stopWithError(err error) {
+	r.stopMx.Lock()
+	r.stopErr = err
+	r.stopMx.Unlock()
+	r.cancelFunc()
 }
 
 func (r *Manager) requestBuild(event WatchEvent) {
+	r.pendingMx.Lock()
+	r.pending = appendEvent(r.pending, event)
+	r.pendingMx.Unlock()
+
 	select {
 	case r.buildRequests <- event:
 		// Sent event to build requests channel
-		log.
+		r.logger().
 			WithField("path", event.Path).
 			WithField("event", event.Type).
 			Debugf("Build requested")
 	default:
-		// Channel is full -> ignore, since there's another pending build request
-		log.Debug("Build request ignored")
+		// Channel is full -> ignore, since there's another pending build request that will include the event
+		r.logger().Debug("Build request ignored")
+	}
+}
+
+// takePendingEvents returns the events since the last build, with only the latest event for every path
+func (r *Manager) takePendingEvents() []WatchEvent {
+	r.pendingMx.Lock()
+	defer r.pendingMx.Unlock()
+	events := r.pending
+	r.pending = nil
+	return events
+}
+
+func appendEvent(events []WatchEvent, event WatchEvent) []WatchEvent {
+	for i, e := range events {
+		if e.Path == event.Path {
+			events = append(events[:i], events[i+1:]...)
+			break
+		}
+	}
+	return append(events, event)
+}
+
+// needsBuild checks if any of the events requires a build and not just a restart
+func needsBuild(events []WatchEvent) bool {
+	for _, e := range events {
+		if e.Action != ActionRestart {
+			return true
+		}
 	}
+	return false
+}
+
+// unchangedBuild checks if the restart after a build can be skipped: the binary is identical to the running one,
+// only Go files changed (other files might be embedded or read at runtime) and all processes are still running
+func unchangedBuild(running, built [md5.Size]byte, events []WatchEvent, processesRunning bool) bool {
+	return built == running && onlyGoFiles(events) && processesRunning
 }
 
-func (r *Manager) build(event WatchEvent) error {
+// onlyGoFiles checks if all events are changes of Go files, so an unchanged binary means no change at all
+func onlyGoFiles(events []WatchEvent) bool {
+	for _, e := range events {
+		if e.Type == "init" || filepath.Ext(e.Path) != ".go" {
+			return false
+		}
+	}
+	return true
+}
+
+// errUnableToBuild stops a manager if the build target has no buildable Go files, other services keep running
+var errUnableToBuild = errors.New("unable to build")
+
+func (r *Manager) build(events []WatchEvent) error {
+	r.setBuilding(true)
+	defer r.setBuilding(false)
+
+	event := events[0]
 	now := time.Now()
-	log.
+	lastBuild := r.LastBuild()
+	r.logger().
+		WithField(LifecycleField, LifecycleBuildStart).
 		WithField("path", event.Path).
 		WithField("event", event.Type).
 		Infof("Building...")
@@ -114,30 +296,142 @@ func (r *Manager) build(event WatchEvent) error {
 	args = append(args, r.BuildFlags...)
 	args = append(args, "-o", r.FullBuildPath(), r.BuildTargetPath)
 	cmd := exec.CommandContext(r.context, "go", args...)
+	// The output is shown while building and kept for the control API, startCommand captures it for the diagnostics
+	if r.logs != nil {
+		cmd.Stderr = io.MultiWriter(r.stderr(), r.logs)
+	}
+
+	stderr, err := r.startCommand(cmd)
+	if err == nil {
+		err = r.waitCommand(cmd, stderr)
+	}
+	tt := time.Since(now)
+
+	// Imports might have changed, also if the build failed
+	if r.affectedOnly {
+		go r.updateDeps()
+	}
 
-	err := r.runAndListen(cmd)
 	if err != nil {
+		// Stop instead of exiting, so processes are stopped, the terminal is restored and other services keep running
 		if strings.Contains(err.Error(), "no buildable Go source files") {
-			r.cancelFunc()
-			log.WithError(err).Fatal("Unable to build")
+			r.logger().
+				WithField(LifecycleField, LifecycleBuildFailed).
+				WithError(err).
+				Error("Unable to build")
+			r.stopWithError(fmt.Errorf("%w: %v", errUnableToBuild, err))
+			return nil
 		}
-		return err
+
+		buildErr := &BuildError{Err: err}
+		if stderr != nil {
+			buildErr.Output = stderr.String()
+			buildErr.Diagnostics = parseDiagnostics(buildErr.Output, r.AppRoot)
+		}
+		result := BuildResult{
+			Time:        now,
+			Duration:    tt,
+			TriggerPath: event.Path,
+			Diagnostics: buildErr.Diagnostics,
+		}
+		// Errors without a position (e.g. of the go command) are only in the raw output
+		if len(buildErr.Diagnostics) == 0 {
+			result.Output = buildErr.Output
+		}
+		r.setLastBuild(result)
+		return buildErr
 	}
 
-	tt := time.Since(now)
-	log.
-		WithField("pid", cmd.Process.Pid).
-		WithField("duration", tt).
-		Debugf("Build complete")
+	r.setLastBuild(BuildResult{
+		Success:     true,
+		Time:        now,
+		Duration:    tt,
+		TriggerPath: event.Path,
+	})
+
+	r.logger().
+		WithField(LifecycleField, LifecycleBuildOK).
+		WithField("duration", tt.Round(time.Millisecond)).
+		Info("Build complete")
+
+	// Skip the restart if the binary is byte-identical (e.g. after comment-only changes) to keep the state of the app
+	hash, err := binaryHash(r.FullBuildPath())
+	r.activeMx.Lock()
+	runningHash := r.binaryHash
+	r.binaryHash = hash
+	r.activeMx.Unlock()
+	unchanged := err == nil && r.binaryPath() == r.FullBuildPath() && unchangedBuild(runningHash, hash, events, r.processesRunning())
+	if unchanged {
+		r.logger().Info("binary unchanged, not restarting")
+		// Clients still show the error overlay of the failed build, a reload removes it
+		if lastBuild != nil && !lastBuild.Success {
+			r.setRestartCause(r.activeBuildID(), events, tt)
+			go r.notifyLiveReloadRestart()
+		}
+		return nil
+	}
+
+	r.recordBuild(event, tt)
+	r.setRestartCause(r.nextBuildID(), events, tt)
+
 	r.Restart <- true
 	return nil
 }
 
+// logBuildError logs a summary of the diagnostics or the raw error if the output could not be parsed.
+// The output of go build is already shown and in the logs of the control API. With JSON logs the
+// diagnostics are only in the fields of the log entry.
+func (r *Manager) logBuildError(err error) {
+	var buildErr *BuildError
+	isBuildErr := errors.As(err, &buildErr)
+	if !isBuildErr || len(buildErr.Diagnostics) == 0 {
+		r.logger().
+			WithField(LifecycleField, LifecycleBuildFailed).
+			WithError(err).
+			Error("Build error occurred")
+		if r.logs != nil && !isBuildErr {
+			fmt.Fprintf(r.logs, "Build error occurred: %s\n", err)
+		}
+		return
+	}
+
+	r.logger().
+		WithField(LifecycleField, LifecycleBuildFailed).
+		WithField("errors", len(buildErr.Diagnostics)).
+		WithField(DiagnosticsField, buildErr.Diagnostics).
+		Error("Build failed")
+
+	if !r.JSONLogs {
+		printDiagnostics(r.stderr(), buildErr.Diagnostics)
+	}
+}
+
+// stderr returns the writer for output of refresh and the app
+func (r *Manager) stderr() io.Writer {
+	if r.Stderr != nil {
+		return r.Stderr
+	}
+	return os.Stderr
+}
+
+func (r *Manager) setLastBuild(result BuildResult) {
+	r.lastBuildMx.Lock()
+	defer r.lastBuildMx.Unlock()
+	r.lastBuild = &result
+}
+
+// LastBuild returns the result of the last build or nil if there was no build yet
+func (r *Manager) LastBuild() *BuildResult {
+	r.lastBuildMx.Lock()
+	defer r.lastBuildMx.Unlock()
+	return r.lastBuild
+}
+
 // drainBuildRequests skips request build events until BuildDelay is exceeded
 func (r *Manager) drainBuildRequests(event WatchEvent) {
 	// Do not wait for initial build
 	if event.Type == "init" {
-		log.Debug("drainBuildRequests: Skip init")
+		r.logger().Debug("drainBuildRequests: Skip init")
 		return
 	}
 
@@ -145,124 +439,44 @@ func (r *Manager) drainBuildRequests(event WatchEvent) {
 	for {
 		select {
 		case event = <-r.buildRequests:
-			log.
+			r.logger().
 				WithField("path", event.Path).
 				WithField("event", event.Type).
 				Debugf("drainBuildRequests: Skip event until timer expires")
 		case <-t.C:
-			log.Debug("drainBuildRequests: Timer expired")
+			r.logger().Debug("drainBuildRequests: Timer expired")
 			return
 		}
 	}
 }
 
-func (r *Manager) startLiveReloadServer() {
-	if !r.LiveReload {
-		return
+// newWatcher creates a watcher for the app root, the additional watch roots and the static asset directories of the configuration
+func newWatcher(ctx context.Context, c *Configuration) *Watcher {
+	w := NewWatcher(ctx, c.AppRoot, c.IncludedExtensions, c.IncludedPatterns, c.IgnoredFolders)
+	for _, root := range c.Watch {
+		w.AddRoot(root)
 	}
-
-	r.liveReloadSSE = sse.New()
-	r.liveReloadSSE.AutoReplay = false
-	r.liveReloadSSE.CreateStream("refresh")
-
-	// Start HTTP server with permissive CORS on a random port in the background
-
-	corsMiddleware := cors.New(cors.Options{
-		AllowOriginFunc: func(origin string) bool { return true },
-		AllowedMethods: []string{
-			http.MethodHead,
-			http.MethodGet,
-			http.MethodPost,
-			http.MethodPut,
-			http.MethodPatch,
-			http.MethodDelete,
-		},
-		AllowedHeaders:   []string{"*"},
-		AllowCredentials: true,
-	})
-
-	var srv *httptest.Server
-	mux := http.NewServeMux()
-	mux.Handle("/events", r.liveReloadSSE)
-	mux.HandleFunc("/static/reload.js", func(w http.ResponseWriter, r *http.Request) {
-		file, err := static.Files.ReadFile("reload.js")
-		if err != nil {
-			log.WithError(err).Error("liveReload: Failed to read reload.js")
-			http.Error(w, "Failed to load reload.js", http.StatusInternalServerError)
-			return
-		}
-
-		w.Header().Set("Content-Type", "application/javascript")
-		file = bytes.Replace(file, []byte("${REFRESH_LIVE_RELOAD_SSE_URL}"), []byte(srv.URL+"/events?stream=refresh"), 1)
-		_, _ = w.Write(file)
-	})
-
-	srv = httptest.NewServer(corsMiddleware.Handler(mux))
-
-	log.Debugf("liveReload: Started server on %s", srv.URL)
-
-	// Pass the SSE server URL and event type to the process via env vars
-	r.CommandEnv = append(
-		r.CommandEnv,
-		"REFRESH_LIVE_RELOAD_SSE_URL="+srv.URL+"/events?stream=refresh",
-		"REFRESH_LIVE_RELOAD_SSE_EVENT="+refreshRestartEventName,
-		"REFRESH_LIVE_RELOAD_SCRIPT_URL="+srv.URL+"/static/reload.js",
-	)
-
-	// Close the SSE server when the context is done
-	go func() {
-		<-r.context.Done()
-		r.liveReloadSSE.Close()
-		srv.Close()
-		log.Debug("liveReload: Stopped server")
-	}()
-}
-
-const refreshRestartEventName = "refresh-restart"
-
-func (r *Manager) notifyLiveReloadRestart() {
-	if r.liveReloadSSE == nil {
-		return
+	for _, root := range c.assetRoots() {
+		w.AddRoot(root)
 	}
-
-	if r.ReadynessURL != "" {
-		err := r.waitForReadyness()
-		if err != nil {
-			log.WithError(err).Warn("liveReload: Readyness check failed")
-			return
-		}
+	w.IgnoreEvents(c.IgnoredEvents)
+	if c.WatchAttribEvents {
+		w.WatchAttribEvents()
 	}
-
-	log.Debug("liveReload: Notify restart")
-
-	r.liveReloadSSE.Publish("refresh", &sse.Event{
-		Event: []byte(refreshRestartEventName),
-		Data:  []byte("The server has been restarted"),
-	})
+	if c.DeduplicateEvents {
+		w.DeduplicateEvents()
+	}
+	// The dependencies of the build targets are updated after builds for changed module files
+	if c.BuildAffectedOnly || len(c.Services) > 0 {
+		w.TrackModuleFiles()
+	}
+	return w
 }
 
-func (r *Manager) waitForReadyness() error {
-	log.Debug("liveReload: Waiting for readyness")
-
-	// TODO Check what happens if app never becomes ready?
-
-	return backoff.Retry(func() error {
-		// Check if r.context is done
-		select {
-		case <-r.context.Done():
-			return backoff.Permanent(r.context.Err())
-		default:
-		}
-
-		resp, err := http.Get(r.ReadynessURL)
-		if err != nil {
-			return err
-		}
-		if resp.StatusCode != 200 {
-			return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
-		}
-
-		log.Debug("liveReload: Readyness check successful")
-		return nil
-	}, backoff.NewExponentialBackOff())
+// logger returns the logger of the manager, with the service name in multi-service mode
+func (r *Manager) logger() log.Interface {
+	if r.Name != "" {
+		return log.WithField("service", r.Name)
+	}
+	return log.Log
 }
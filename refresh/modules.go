@@ -0,0 +1,85 @@
+package refresh
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/mod/modfile"
+)
+
+func isModuleFile(path string) bool {
+	base := filepath.Base(path)
+	return base == "go.mod" || base == "go.work"
+}
+
+// localModuleDirs returns the absolute directories of local modules used by the build:
+// replacements with a local path in go.mod or go.work and the members of go.work.
+// The module files are resolved from dir, the app root.
+func localModuleDirs(ctx context.Context, dir string) ([]string, error) {
+	cmd := exec.CommandContext(ctx, "go", "env", "GOMOD", "GOWORK")
+	cmd.Dir = dir
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("getting module files: %w", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+	var goMod, goWork string
+	if len(lines) > 0 {
+		goMod = strings.TrimSpace(lines[0])
+	}
+	if len(lines) > 1 {
+		goWork = strings.TrimSpace(lines[1])
+	}
+
+	var dirs []string
+
+	if goMod != "" && goMod != os.DevNull {
+		data, err := os.ReadFile(goMod)
+		if err != nil {
+			return nil, err
+		}
+		f, err := modfile.Parse(goMod, data, nil)
+		if err != nil {
+			return nil, err
+		}
+		dirs = append(dirs, localReplaceDirs(filepath.Dir(goMod), f.Replace)...)
+	}
+
+	if goWork != "" && goWork != "off" {
+		data, err := os.ReadFile(goWork)
+		if err != nil {
+			return nil, err
+		}
+		f, err := modfile.ParseWork(goWork, data, nil)
+		if err != nil {
+			return nil, err
+		}
+		for _, u := range f.Use {
+			dirs = append(dirs, absModuleDir(filepath.Dir(goWork), u.Path))
+		}
+		dirs = append(dirs, localReplaceDirs(filepath.Dir(goWork), f.Replace)...)
+	}
+
+	return dirs, nil
+}
+
+func localReplaceDirs(base string, replaces []*modfile.Replace) []string {
+	var dirs []string
+	for _, r := range replaces {
+		if r.New.Version == "" && modfile.IsDirectoryPath(r.New.Path) {
+			dirs = append(dirs, absModuleDir(base, r.New.Path))
+		}
+	}
+	return dirs
+}
+
+func absModuleDir(base, path string) string {
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(base, path)
+	}
+	return realDir(path)
+}
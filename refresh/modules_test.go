@@ -0,0 +1,98 @@
+package refresh
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestLocalModuleDirs(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		// appRoot is relative to the temp dir
+		appRoot string
+		// want is relative to the temp dir
+		want []string
+	}{
+		{
+			name: "module without replacements",
+			files: map[string]string{
+				"app/go.mod": "module example.com/app\n\ngo 1.20\n",
+			},
+			appRoot: "app",
+		},
+		{
+			name: "local replacement in go.mod",
+			files: map[string]string{
+				"app/go.mod": "module example.com/app\n\ngo 1.20\n\nreplace example.com/lib => ../lib\n",
+				"lib/go.mod": "module example.com/lib\n\ngo 1.20\n",
+			},
+			appRoot: "app",
+			want:    []string{"lib"},
+		},
+		{
+			name: "versioned replacement is not local",
+			files: map[string]string{
+				"app/go.mod": "module example.com/app\n\ngo 1.20\n\nreplace example.com/lib => example.com/fork v1.0.0\n",
+			},
+			appRoot: "app",
+		},
+		{
+			name: "workspace members and replacements",
+			files: map[string]string{
+				"go.work":      "go 1.20\n\nuse (\n\t./app\n\t./lib\n)\n\nreplace example.com/other => ./other\n",
+				"app/go.mod":   "module example.com/app\n\ngo 1.20\n",
+				"lib/go.mod":   "module example.com/lib\n\ngo 1.20\n",
+				"other/go.mod": "module example.com/other\n\ngo 1.20\n",
+			},
+			appRoot: "app",
+			want:    []string{"app", "lib", "other"},
+		},
+		{
+			name: "module files are resolved from the app root",
+			files: map[string]string{
+				"app/go.mod":     "module example.com/app\n\ngo 1.20\n\nreplace example.com/lib => ./lib\n",
+				"app/lib/go.mod": "module example.com/lib\n\ngo 1.20\n",
+				"other/go.mod":   "module example.com/other\n\ngo 1.20\n\nreplace example.com/lib => ../lib\n",
+			},
+			appRoot: "app",
+			want:    []string{"app/lib"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Do not pick up a workspace or flags of the environment
+			t.Setenv("GOWORK", "")
+			t.Setenv("GOFLAGS", "")
+
+			dir := t.TempDir()
+			for name, content := range tt.files {
+				path := filepath.Join(dir, name)
+				if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+					t.Fatal(err)
+				}
+				writeFile(t, path, content)
+			}
+
+			got, err := localModuleDirs(context.Background(), filepath.Join(dir, tt.appRoot))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var want []string
+			for _, w := range tt.want {
+				want = append(want, realDir(filepath.Join(dir, w)))
+			}
+			sort.Strings(got)
+			sort.Strings(want)
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("localModuleDirs() = %v, want %v", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,60 @@
+package refresh
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+const defaultPortEnv = "PORT"
+
+// allocatePort picks a free TCP port for the process if auto_port is enabled, injects it into
+// the process environment and derives the readyness URL from it.
+func (r *Manager) allocatePort(p *process, implicit bool) error {
+	if !r.AutoPort {
+		return nil
+	}
+
+	port, err := freePort()
+	if err != nil {
+		return fmt.Errorf("allocating free port: %w", err)
+	}
+
+	portEnv := r.PortEnv
+	if portEnv == "" {
+		portEnv = defaultPortEnv
+	}
+
+	p.appURL = fmt.Sprintf("http://localhost:%d", port)
+	p.portEnv = portEnv + "=" + strconv.Itoa(port)
+
+	// The readyness URL can reference the allocated port with a ${PORT} placeholder.
+	// A single app without a readyness URL is checked at its root, it is ready if it responds with any status.
+	if p.readynessURL == "" && implicit {
+		p.readynessURL = p.appURL + "/"
+		p.readyOnAnyStatus = true
+	} else {
+		p.readynessURL = strings.ReplaceAll(p.readynessURL, "${PORT}", strconv.Itoa(port))
+	}
+
+	l := r.logger().
+		WithField("env", portEnv).
+		WithField("url", p.appURL)
+	if p.Name != "" {
+		l = l.WithField("process", p.Name)
+	}
+	l.Infof("Allocated port %d", port)
+
+	return nil
+}
+
+// freePort asks the kernel for a currently unused TCP port.
+func freePort() (int, error) {
+	l, err := net.Listen("tcp", ":0")
+	if err != nil {
+		return 0, err
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port, nil
+}
@@ -0,0 +1,90 @@
+package refresh
+
+import (
+	"os/exec"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestManager_allocatePort(t *testing.T) {
+	tests := []struct {
+		name         string
+		portEnv      string
+		implicit     bool
+		readynessURL string
+		wantEnv      string
+		wantReady    string
+		wantAny      bool
+	}{
+		{
+			name:      "implicit process is checked at its root",
+			implicit:  true,
+			wantEnv:   "PORT",
+			wantReady: "http://localhost:${PORT}/",
+			wantAny:   true,
+		},
+		{
+			name:         "placeholder in readyness URL",
+			portEnv:      "HTTP_PORT",
+			readynessURL: "http://localhost:${PORT}/health",
+			wantEnv:      "HTTP_PORT",
+			wantReady:    "http://localhost:${PORT}/health",
+		},
+		{
+			name:    "named process without readyness URL",
+			wantEnv: "PORT",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &Manager{Configuration: &Configuration{AutoPort: true, PortEnv: tt.portEnv}}
+			p := &process{readynessURL: tt.readynessURL}
+
+			if err := r.allocatePort(p, tt.implicit); err != nil {
+				t.Fatal(err)
+			}
+
+			name, value, _ := strings.Cut(p.portEnv, "=")
+			if name != tt.wantEnv {
+				t.Errorf("port variable = %q, want %q", name, tt.wantEnv)
+			}
+			if port, err := strconv.Atoi(value); err != nil || port == 0 {
+				t.Errorf("port = %q, want a port number", value)
+			}
+			if want := strings.ReplaceAll(tt.wantReady, "${PORT}", value); p.readynessURL != want {
+				t.Errorf("readyness URL = %q, want %q", p.readynessURL, want)
+			}
+			if p.readyOnAnyStatus != tt.wantAny {
+				t.Errorf("ready on any status = %v, want %v", p.readyOnAnyStatus, tt.wantAny)
+			}
+		})
+	}
+}
+
+func TestProcessEnv(t *testing.T) {
+	t.Setenv("REFRESH_TEST_INHERITED", "inherited")
+	t.Setenv("PORT", "8080")
+
+	cmd := exec.Command("true")
+	cmd.Env = processEnv([]string{"REFRESH_TEST_INHERITED=configured", "REFRESH_TEST_CONFIGURED=configured"}, "PORT=4242")
+
+	env := make(map[string]string)
+	for _, kv := range cmd.Environ() {
+		k, v, _ := strings.Cut(kv, "=")
+		env[k] = v
+	}
+
+	// The inherited environment takes precedence over command_env, as it always did
+	if got := env["REFRESH_TEST_INHERITED"]; got != "inherited" {
+		t.Errorf("REFRESH_TEST_INHERITED = %q, want inherited", got)
+	}
+	if got := env["REFRESH_TEST_CONFIGURED"]; got != "configured" {
+		t.Errorf("REFRESH_TEST_CONFIGURED = %q, want configured", got)
+	}
+	// The allocated port overrides an inherited PORT
+	if got := env["PORT"]; got != "4242" {
+		t.Errorf("PORT = %q, want 4242", got)
+	}
+}
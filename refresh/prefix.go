@@ -0,0 +1,139 @@
+package refresh
+
+import (
+	"bytes"
+	"hash/fnv"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/fatih/color"
+)
+
+var processColors = []color.Attribute{
+	color.FgCyan,
+	color.FgMagenta,
+	color.FgGreen,
+	color.FgBlue,
+	color.FgYellow,
+}
+
+// processPrefix returns a colored prefix for the output of the named process
+func processPrefix(name string) string {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(name))
+	c := color.New(processColors[h.Sum32()%uint32(len(processColors))])
+	return c.Sprintf("[%s]", name) + " "
+}
+
+const (
+	// prefixIdleFlush is the time after which an incomplete line is written, e.g. a prompt without a newline
+	prefixIdleFlush = 100 * time.Millisecond
+	// prefixMaxLine is the size after which an incomplete line is written without waiting for the newline
+	prefixMaxLine = 64 * 1024
+)
+
+// prefixWriter prefixes every line written to the underlying writer.
+// Incomplete lines are buffered until the line is complete, the writer is idle or flushed.
+type prefixWriter struct {
+	mu     sync.Mutex
+	w      io.Writer
+	prefix []byte
+	buf    []byte
+	// passthrough writes incomplete lines immediately, used for the process reading from stdin
+	passthrough bool
+	// midLine is set after an incomplete line was written, the rest of the line is written without a prefix
+	midLine bool
+	timer   *time.Timer
+}
+
+func newPrefixWriter(w io.Writer, prefix string) *prefixWriter {
+	return &prefixWriter{
+		w:      w,
+		prefix: []byte(prefix),
+	}
+}
+
+func (pw *prefixWriter) Write(p []byte) (int, error) {
+	pw.mu.Lock()
+	defer pw.mu.Unlock()
+
+	pw.buf = append(pw.buf, p...)
+	for {
+		i := bytes.IndexByte(pw.buf, '\n')
+		if i < 0 {
+			break
+		}
+		err := pw.writeLine(pw.buf[:i+1])
+		pw.buf = pw.buf[i+1:]
+		if err != nil {
+			return len(p), err
+		}
+	}
+	if len(pw.buf) == 0 {
+		return len(p), nil
+	}
+
+	if pw.passthrough || len(pw.buf) >= prefixMaxLine {
+		return len(p), pw.writePartial()
+	}
+	if pw.timer == nil {
+		pw.timer = time.AfterFunc(prefixIdleFlush, pw.flushIdle)
+	} else {
+		pw.timer.Reset(prefixIdleFlush)
+	}
+	return len(p), nil
+}
+
+// Flush writes a pending incomplete line and ends it
+func (pw *prefixWriter) Flush() error {
+	pw.mu.Lock()
+	defer pw.mu.Unlock()
+
+	if pw.timer != nil {
+		pw.timer.Stop()
+	}
+	if len(pw.buf) == 0 && !pw.midLine {
+		return nil
+	}
+	err := pw.writeLine(append(pw.buf, '\n'))
+	pw.buf = nil
+	return err
+}
+
+func (pw *prefixWriter) flushIdle() {
+	pw.mu.Lock()
+	defer pw.mu.Unlock()
+
+	_ = pw.writePartial()
+}
+
+// writePartial writes the incomplete line without waiting for the newline
+func (pw *prefixWriter) writePartial() error {
+	if len(pw.buf) == 0 {
+		return nil
+	}
+	err := pw.writeLine(pw.buf)
+	pw.buf = nil
+	pw.midLine = true
+	return err
+}
+
+func (pw *prefixWriter) writeLine(line []byte) error {
+	out := make([]byte, 0, len(pw.prefix)+len(line))
+	if !pw.midLine {
+		out = append(out, pw.prefix...)
+	}
+	out = append(out, line...)
+	pw.midLine = false
+	_, err := pw.w.Write(out)
+	return err
+}
+
+func flushWriters(writers ...io.Writer) {
+	for _, w := range writers {
+		if pw, ok := w.(*prefixWriter); ok && pw != nil {
+			_ = pw.Flush()
+		}
+	}
+}
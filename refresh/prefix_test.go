@@ -0,0 +1,132 @@
+package refresh
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestPrefixWriter(t *testing.T) {
+	tests := []struct {
+		name        string
+		writes      []string
+		passthrough bool
+		flush       bool
+		want        string
+	}{
+		{
+			name:   "single line",
+			writes: []string{"hello\n"},
+			want:   "[app] hello\n",
+		},
+		{
+			name:   "several lines in one write",
+			writes: []string{"one\ntwo\n"},
+			want:   "[app] one\n[app] two\n",
+		},
+		{
+			name:   "line split across writes",
+			writes: []string{"hel", "lo\nwor", "ld\n"},
+			want:   "[app] hello\n[app] world\n",
+		},
+		{
+			name:   "incomplete line is buffered",
+			writes: []string{"done\npartial"},
+			want:   "[app] done\n",
+		},
+		{
+			name:   "flush writes incomplete line",
+			writes: []string{"done\npartial"},
+			flush:  true,
+			want:   "[app] done\n[app] partial\n",
+		},
+		{
+			name:   "flush without pending output",
+			writes: []string{"done\n"},
+			flush:  true,
+			want:   "[app] done\n",
+		},
+		{
+			name:        "passthrough writes incomplete line",
+			writes:      []string{"Name? "},
+			passthrough: true,
+			want:        "[app] Name? ",
+		},
+		{
+			name:        "rest of a written incomplete line has no prefix",
+			writes:      []string{"Name? ", "bob\n", "next\n"},
+			passthrough: true,
+			want:        "[app] Name? bob\n[app] next\n",
+		},
+		{
+			name:        "flush ends a written incomplete line",
+			writes:      []string{"Name? "},
+			passthrough: true,
+			flush:       true,
+			want:        "[app] Name? \n",
+		},
+		{
+			name:   "long incomplete line is written",
+			writes: []string{strings.Repeat("x", prefixMaxLine), "y\n"},
+			want:   "[app] " + strings.Repeat("x", prefixMaxLine) + "y\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Incomplete lines can be written by the idle timer after the test
+			var buf lockedBuffer
+			pw := newPrefixWriter(&buf, "[app] ")
+			pw.passthrough = tt.passthrough
+			for _, s := range tt.writes {
+				n, err := pw.Write([]byte(s))
+				if err != nil || n != len(s) {
+					t.Fatalf("Write(%q) = %d, %v", s, n, err)
+				}
+			}
+			if tt.flush {
+				flushWriters(pw)
+			}
+			if got := buf.String(); got != tt.want {
+				t.Errorf("output = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFlushWriters_nilPrefixWriter(t *testing.T) {
+	var pw *prefixWriter
+	// Must not panic for processes without a log buffer
+	flushWriters(&bytes.Buffer{}, pw)
+}
+
+func TestPrefixWriter_idleFlush(t *testing.T) {
+	var out lockedBuffer
+	pw := newPrefixWriter(&out, "[app] ")
+	_, _ = pw.Write([]byte("Name? "))
+
+	waitFor(t, func() bool { return out.String() == "[app] Name? " })
+
+	_, _ = pw.Write([]byte("bob\n"))
+	if got, want := out.String(), "[app] Name? bob\n"; got != want {
+		t.Errorf("output = %q, want %q", got, want)
+	}
+}
+
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
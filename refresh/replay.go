@@ -0,0 +1,162 @@
+package refresh
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/apex/log"
+)
+
+// replayBufferSize is the number of live reload events that are kept for clients that reconnect
+const replayBufferSize = 100
+
+type replayEvent struct {
+	seq   uint64
+	id    string
+	event string
+	data  []byte
+}
+
+// replayBuffer assigns IDs to live reload events and keeps the last events for replaying them to reconnecting clients.
+// IDs are prefixed with an instance that changes on every start of refresh, so IDs of a previous run are detected.
+type replayBuffer struct {
+	mu       sync.Mutex
+	instance string
+	seq      uint64
+	events   []replayEvent
+	size     int
+}
+
+func newReplayBuffer(size int) *replayBuffer {
+	return &replayBuffer{
+		instance: strconv.FormatInt(time.Now().UnixNano(), 36),
+		size:     size,
+	}
+}
+
+// add stores the event and returns its ID
+func (b *replayBuffer) add(event string, data []byte) string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.seq++
+	e := replayEvent{
+		seq:   b.seq,
+		id:    b.id(b.seq),
+		event: event,
+		data:  data,
+	}
+	if len(b.events) >= b.size {
+		b.events = append(b.events[:0], b.events[1:]...)
+	}
+	b.events = append(b.events, e)
+	return e.id
+}
+
+func (b *replayBuffer) id(seq uint64) string {
+	return b.instance + "-" + strconv.FormatUint(seq, 10)
+}
+
+// since returns the events after the given ID. If events were missed that are not in the buffer anymore
+// or the ID is from a previous run, missed is true and the ID of the last event is returned.
+func (b *replayBuffer) since(lastID string) (events []replayEvent, missed bool, currentID string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	currentID = b.id(b.seq)
+
+	instance, seqStr, ok := strings.Cut(lastID, "-")
+	seq, err := strconv.ParseUint(seqStr, 10, 64)
+	if !ok || err != nil || instance != b.instance || seq > b.seq {
+		return nil, true, currentID
+	}
+	if len(b.events) > 0 && seq+1 < b.events[0].seq {
+		return nil, true, currentID
+	}
+
+	for _, e := range b.events {
+		if e.seq > seq {
+			events = append(events, e)
+		}
+	}
+	return events, false, currentID
+}
+
+// missedEvent is sent instead of a replay if a client missed events that are not in the replay buffer anymore.
+// It is a restart event, so clients reload the page once.
+func missedEvent(id string) replayEvent {
+	data, _ := json.Marshal(restartPayload{
+		Version:      restartPayloadVersion,
+		ChangedFiles: []string{},
+		Message:      "Missed events while reconnecting",
+		Missed:       true,
+		Time:         time.Now(),
+	})
+	return replayEvent{
+		id:    id,
+		event: refreshRestartEventName,
+		data:  data,
+	}
+}
+
+// replay returns the events a client with the given last event ID has to receive after reconnecting
+func (b *replayBuffer) replay(lastID string) []replayEvent {
+	if lastID == "" {
+		return nil
+	}
+	events, missed, currentID := b.since(lastID)
+	if missed {
+		return []replayEvent{missedEvent(currentID)}
+	}
+	return events
+}
+
+// lastEventID returns the ID of the last event a reconnecting client received. Clients pass it in the
+// Last-Event-ID header on automatic reconnects or in the lastEventId query parameter on new connections.
+func lastEventID(r *http.Request) string {
+	if id := r.URL.Query().Get("lastEventId"); id != "" {
+		return id
+	}
+	return r.Header.Get("Last-Event-ID")
+}
+
+// replayWriter writes the missed events right after the SSE response was started. They are looked up
+// after the client subscribed to the stream, so no event is lost in between (clients skip duplicates).
+type replayWriter struct {
+	http.ResponseWriter
+	replay *replayBuffer
+	lastID string
+}
+
+func (w *replayWriter) WriteHeader(code int) {
+	w.ResponseWriter.WriteHeader(code)
+	if code != http.StatusOK {
+		return
+	}
+
+	events := w.replay.replay(w.lastID)
+	if len(events) == 0 {
+		return
+	}
+	log.
+		WithField("lastEventId", w.lastID).
+		Debugf("liveReload: Replaying %d events", len(events))
+
+	var buf bytes.Buffer
+	for _, e := range events {
+		fmt.Fprintf(&buf, "id: %s\ndata: %s\nevent: %s\n\n", e.id, e.data, e.event)
+	}
+	_, _ = w.ResponseWriter.Write(buf.Bytes())
+}
+
+func (w *replayWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
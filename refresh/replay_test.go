@@ -0,0 +1,97 @@
+package refresh
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestReplayBuffer_replay(t *testing.T) {
+	b := newReplayBuffer(3)
+	var ids []string
+	for _, event := range []string{"a", "b", "c", "d"} {
+		ids = append(ids, b.add(event, []byte(event)))
+	}
+
+	tests := []struct {
+		name   string
+		lastID string
+		want   []string
+	}{
+		{
+			name:   "no last event ID",
+			lastID: "",
+			want:   nil,
+		},
+		{
+			name:   "up to date",
+			lastID: ids[3],
+			want:   nil,
+		},
+		{
+			name:   "missed events in buffer",
+			lastID: ids[1],
+			want:   []string{"c", "d"},
+		},
+		{
+			name:   "oldest event in buffer is the next event",
+			lastID: ids[0],
+			want:   []string{"b", "c", "d"},
+		},
+		{
+			name:   "missed events not in buffer anymore",
+			lastID: b.instance + "-0",
+			want:   []string{refreshRestartEventName},
+		},
+		{
+			name:   "ID of a previous run",
+			lastID: "previous-4",
+			want:   []string{refreshRestartEventName},
+		},
+		{
+			name:   "ID after the last event",
+			lastID: b.instance + "-5",
+			want:   []string{refreshRestartEventName},
+		},
+		{
+			name:   "invalid ID",
+			lastID: "invalid",
+			want:   []string{refreshRestartEventName},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			events := b.replay(tt.lastID)
+			var got []string
+			for _, e := range events {
+				got = append(got, e.event)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("replay(%q) = %v, want %v", tt.lastID, got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("replay(%q) = %v, want %v", tt.lastID, got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestReplayWriter(t *testing.T) {
+	b := newReplayBuffer(10)
+	lastID := b.add("a", []byte(`"a"`))
+
+	rec := httptest.NewRecorder()
+	w := &replayWriter{ResponseWriter: rec, replay: b, lastID: lastID}
+
+	// Events published until the response is started are replayed
+	id := b.add("b", []byte(`"b"`))
+	w.WriteHeader(http.StatusOK)
+
+	want := "id: " + id + "\ndata: \"b\"\nevent: b\n\n"
+	if got := rec.Body.String(); got != want {
+		t.Errorf("body = %q, want %q", got, want)
+	}
+}
@@ -2,68 +2,350 @@ package refresh
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"os/exec"
 	"strings"
+	"sync"
 	"syscall"
+	"time"
 
 	"github.com/apex/log"
 )
 
-func (r *Manager) runner() {
-	var cmd *exec.Cmd
-	stopProcess := func() {
-		if cmd != nil && cmd.Process != nil {
-			// kill the previous command
-			pid := cmd.Process.Pid
-			log.
-				WithField("pid", pid).
-				Info("Stopping process")
-			_ = cmd.Process.Signal(syscall.SIGTERM)
-			_, _ = cmd.Process.Wait()
+// processRestartDelay is the time to wait before a process that exited by itself is restarted by its restart policy
+const processRestartDelay = time.Second
+
+// outputWaitDelay is the time to wait for the output of a command after it exited. Children that outlive the
+// command (e.g. of a shell wrapper) keep the output open, their output is not waited for after the delay.
+const outputWaitDelay = time.Second
+
+type process struct {
+	Process
+	env          []string
+	appURL       string
+	readynessURL string
+	// readyOnAnyStatus is set if the readyness URL is derived from the app URL, any response means the app is listening
+	readyOnAnyStatus bool
+	stdin            io.Reader
+	stdout           io.Writer
+	stderr           io.Writer
+	// logs writes the output to the log buffer of the manager
+	logs *prefixWriter
+	// portEnv is the allocated port variable, it takes precedence over the inherited environment
+	portEnv string
+
+	mu       sync.Mutex
+	cmd      *exec.Cmd
+	running  bool
+	crashed  bool
+	stopping chan struct{}
+	done     chan struct{}
+}
+
+func (r *Manager) setupProcesses() error {
+	processes := r.Processes
+	implicit := len(processes) == 0
+	if implicit {
+		processes = []Process{{
+			CommandFlags: r.CommandFlags,
+			ReadynessURL: r.ReadynessURL,
+		}}
+	}
+
+	r.processes = make([]*process, 0, len(processes))
+	for i, pc := range processes {
+		if !implicit && pc.Name == "" {
+			return fmt.Errorf("process %d: missing name", i)
+		}
+		switch pc.Restart {
+		case "", RestartNever, RestartOnFailure, RestartAlways:
+		default:
+			return fmt.Errorf("process %q: invalid restart policy %q", pc.Name, pc.Restart)
+		}
+
+		p := &process{
+			Process:      pc,
+			env:          append(append([]string{}, r.CommandEnv...), pc.CommandEnv...),
+			readynessURL: pc.ReadynessURL,
+			stdout:       r.Stdout,
+			stderr:       r.Stderr,
+		}
+		if p.stdout == nil {
+			p.stdout = os.Stdout
 		}
+		if p.stderr == nil {
+			p.stderr = os.Stderr
+		}
+		// Only one process can read from stdin
+		if i == 0 {
+			p.stdin = r.Stdin
+			if p.stdin == nil {
+				p.stdin = os.Stdin
+			}
+		} else {
+			p.stdin = bytes.NewReader(nil)
+		}
+		name := r.processName(pc)
+		if name != "" {
+			prefix := processPrefix(name)
+			stdout := newPrefixWriter(p.stdout, prefix)
+			stderr := newPrefixWriter(p.stderr, prefix)
+			// Prompts of the process reading from stdin are shown without waiting for the newline
+			stdout.passthrough = i == 0
+			stderr.passthrough = i == 0
+			p.stdout = stdout
+			p.stderr = stderr
+		}
+		if r.logs != nil {
+			prefix := ""
+			if name != "" {
+				prefix = "[" + name + "] "
+			}
+			p.logs = newPrefixWriter(r.logs, prefix)
+		}
+
+		err := r.allocatePort(p, implicit)
+		if err != nil {
+			return err
+		}
+
+		r.processes = append(r.processes, p)
 	}
+	return nil
+}
+
+// processName returns the name of a process for output prefixes, including the service name in multi-service mode
+func (r *Manager) processName(pc Process) string {
+	switch {
+	case r.Name != "" && pc.Name != "":
+		return r.Name + "/" + pc.Name
+	case r.Name != "":
+		return r.Name
+	}
+	return pc.Name
+}
+
+func (r *Manager) runner() {
 	for {
 		select {
 		case <-r.Restart:
-			stopProcess()
-			if r.Debug {
-				bp := r.FullBuildPath()
-				args := []string{"exec", bp}
-				args = append(args, r.CommandFlags...)
-				cmd = exec.Command("dlv", args...)
-			} else {
-				cmd = exec.Command(r.FullBuildPath(), r.CommandFlags...)
+			r.setStarting(true)
+			r.stopProcesses()
+			for _, p := range r.processes {
+				p.start(r)
 			}
-			go func() {
-				log.Info("Starting process")
-				err := r.runAndListen(cmd)
-				if err != nil {
-					log.Error(err.Error())
-				}
-			}()
 			r.notifyLiveReloadRestart()
+			r.setStarting(false)
 		case <-r.context.Done():
-			stopProcess()
+			r.stopProcesses()
+			return
+		}
+	}
+}
+
+// processesRunning checks if all processes are currently running
+func (r *Manager) processesRunning() bool {
+	for _, p := range r.processes {
+		p.mu.Lock()
+		running := p.running
+		p.mu.Unlock()
+		if !running {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *Manager) stopProcesses() {
+	var wg sync.WaitGroup
+	for _, p := range r.processes {
+		wg.Add(1)
+		go func(p *process) {
+			defer wg.Done()
+			p.stop(r.logger())
+		}(p)
+	}
+	wg.Wait()
+}
+
+// processEnv returns the environment of a process. The inherited environment takes precedence over
+// the configured variables, only the allocated port variable (if any) overrides it.
+func processEnv(env []string, portEnv string) []string {
+	result := append(append([]string{}, env...), os.Environ()...)
+	if portEnv != "" {
+		result = append(result, portEnv)
+	}
+	return result
+}
+
+func (r *Manager) processCommand(p *process) *exec.Cmd {
+	var cmd *exec.Cmd
+	bp := r.binaryPath()
+	if r.Debug {
+		args := []string{"exec", bp}
+		args = append(args, p.CommandFlags...)
+		cmd = exec.Command("dlv", args...)
+	} else {
+		cmd = exec.Command(bp, p.CommandFlags...)
+	}
+	cmd.Env = processEnv(p.env, p.portEnv)
+	cmd.Stdin = p.stdin
+	cmd.Stdout = p.stdout
+	cmd.Stderr = p.stderr
+	if p.logs != nil {
+		cmd.Stdout = io.MultiWriter(p.stdout, p.logs)
+		cmd.Stderr = io.MultiWriter(p.stderr, p.logs)
+	}
+	return cmd
+}
+
+func (p *process) start(r *Manager) {
+	p.stopping = make(chan struct{})
+	p.done = make(chan struct{})
+	go p.supervise(r, p.stopping, p.done)
+}
+
+// supervise runs the process and restarts it according to its restart policy until it is stopped
+func (p *process) supervise(r *Manager, stopping, done chan struct{}) {
+	defer close(done)
+
+	l := r.logger()
+	if p.Name != "" {
+		l = l.WithField("process", p.Name)
+	}
+
+	for {
+		cmd := r.processCommand(p)
+
+		p.mu.Lock()
+		select {
+		case <-stopping:
+			p.mu.Unlock()
+			return
+		default:
+		}
+		l.WithField(LifecycleField, LifecycleProcessStart).Info("Starting process")
+		stderr, err := r.startCommand(cmd)
+		p.cmd = cmd
+		p.running = err == nil
+		p.crashed = false
+		p.mu.Unlock()
+
+		if err == nil {
+			err = r.waitCommand(cmd, stderr)
+			p.mu.Lock()
+			p.running = false
+			p.mu.Unlock()
+		}
+		flushWriters(p.stdout, p.stderr, p.logs)
+
+		select {
+		case <-stopping:
+			return
+		default:
+		}
+
+		exitLog := l.WithField(LifecycleField, LifecycleProcessExit)
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			exitLog = exitLog.WithField("exit_code", exitErr.ExitCode())
+		}
+		if err == nil {
+			exitLog.WithField("exit_code", 0).Info("Process exited")
+		} else {
+			exitLog.Error(err.Error())
+			output := ""
+			if stderr != nil {
+				output = stderr.String()
+			}
+			r.notifyLiveReloadCrash(p, err, output)
+		}
+		if !p.shouldRestart(err) {
+			if err != nil {
+				p.mu.Lock()
+				p.crashed = true
+				p.mu.Unlock()
+			}
+			return
+		}
+
+		l.Warnf("Restarting process in %s", processRestartDelay)
+		select {
+		case <-stopping:
 			return
+		case <-time.After(processRestartDelay):
 		}
 	}
 }
 
+func (p *process) shouldRestart(err error) bool {
+	switch p.Restart {
+	case RestartAlways:
+		return true
+	case RestartOnFailure:
+		return err != nil
+	}
+	return false
+}
+
+func (p *process) stop(l log.Interface) {
+	if p.stopping == nil {
+		return
+	}
+
+	p.mu.Lock()
+	close(p.stopping)
+	cmd := p.cmd
+	p.mu.Unlock()
+
+	if cmd != nil && cmd.Process != nil {
+		// kill the previous command
+		l = l.WithField("pid", cmd.Process.Pid)
+		if p.Name != "" {
+			l = l.WithField("process", p.Name)
+		}
+		l.Info("Stopping process")
+		if err := cmd.Process.Signal(syscall.SIGTERM); err != nil {
+			_ = cmd.Process.Kill()
+		}
+	}
+
+	<-p.done
+	p.stopping = nil
+	p.cmd = nil
+}
+
 func (r *Manager) runAndListen(cmd *exec.Cmd) error {
-	cmd.Stderr = r.Stderr
+	stderr, err := r.startCommand(cmd)
+	if err != nil {
+		return err
+	}
+	return r.waitCommand(cmd, stderr)
+}
+
+// startCommand starts the command with the configured streams and environment.
+// The returned buffer captures stderr for error reporting.
+func (r *Manager) startCommand(cmd *exec.Cmd) (*bytes.Buffer, error) {
+	if cmd.Stderr == nil {
+		cmd.Stderr = r.Stderr
+	}
 	if cmd.Stderr == nil {
 		cmd.Stderr = os.Stderr
 	}
 
-	cmd.Stdin = r.Stdin
+	if cmd.Stdin == nil {
+		cmd.Stdin = r.Stdin
+	}
 	if cmd.Stdin == nil {
 		cmd.Stdin = os.Stdin
 	}
 
-	cmd.Stdout = r.Stdout
+	if cmd.Stdout == nil {
+		cmd.Stdout = r.Stdout
+	}
 	if cmd.Stdout == nil {
 		cmd.Stdout = os.Stdout
 	}
@@ -71,23 +353,27 @@ func (r *Manager) runAndListen(cmd *exec.Cmd) error {
 	var stderr bytes.Buffer
 
 	cmd.Stderr = io.MultiWriter(&stderr, cmd.Stderr)
+	cmd.WaitDelay = outputWaitDelay
 
-	// Set the environment variables from config
-	if len(r.CommandEnv) != 0 {
-		cmd.Env = append(r.CommandEnv, os.Environ()...)
+	if cmd.Env == nil && len(r.CommandEnv) != 0 {
+		cmd.Env = processEnv(r.CommandEnv, "")
 	}
 
 	err := cmd.Start()
 	if err != nil {
-		return fmt.Errorf("%s\n%s", err, stderr.String())
+		return nil, fmt.Errorf("%s\n%s", err, stderr.String())
 	}
 
-	log.
+	r.logger().
 		WithField("pid", cmd.Process.Pid).
 		Debugf("Running: %s", strings.Join(cmd.Args, " "))
-	err = cmd.Wait()
+	return &stderr, nil
+}
+
+func (r *Manager) waitCommand(cmd *exec.Cmd, stderr *bytes.Buffer) error {
+	err := cmd.Wait()
 	if _, ok := err.(*exec.ExitError); ok {
-		return fmt.Errorf("%s\n%s", err, stderr.String())
+		return fmt.Errorf("%w\n%s", err, stderr.String())
 	}
 	return nil
 }
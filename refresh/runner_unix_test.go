@@ -0,0 +1,41 @@
+//go:build !windows
+
+package refresh
+
+import (
+	"context"
+	"io"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestProcess_stopWithChildOutlivingIt(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	c := &Configuration{BuildPath: t.TempDir(), BinaryName: "app", Stdout: io.Discard, Stderr: io.Discard}
+	// A shell wrapper that leaves a child running, it keeps the output of the app open
+	writeFile(t, c.FullBuildPath(), "#!/bin/sh\nsleep 5 &\nexec sleep 5\n")
+	if err := os.Chmod(c.FullBuildPath(), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	r := NewWithContext(c, ctx)
+	if err := r.setupProcesses(); err != nil {
+		t.Fatal(err)
+	}
+	p := r.processes[0]
+	p.start(r)
+	waitFor(t, func() bool {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		return p.running
+	})
+
+	started := time.Now()
+	p.stop(r.logger())
+	if d := time.Since(started); d > 3*time.Second {
+		t.Errorf("stopping took %s, want at most %s", d, outputWaitDelay)
+	}
+}
@@ -0,0 +1,38 @@
+//go:build !windows
+
+package refresh
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// handleSignals reacts to signals for controlling the managers:
+// SIGUSR1 pauses or resumes watching of all services together,
+// SIGUSR2 restarts the apps on the previous build if the build history is enabled.
+func handleSignals(ctx context.Context, managers []*Manager) {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGUSR1, syscall.SIGUSR2)
+	go func() {
+		defer signal.Stop(c)
+		for {
+			select {
+			case sig := <-c:
+				if sig == syscall.SIGUSR1 {
+					togglePause(managers)
+					continue
+				}
+				for _, m := range managers {
+					err := m.Rollback()
+					if err != nil {
+						m.logger().WithError(err).Warn("Rollback failed")
+					}
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
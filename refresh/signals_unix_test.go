@@ -0,0 +1,39 @@
+//go:build !windows
+
+package refresh
+
+import (
+	"context"
+	"syscall"
+	"testing"
+)
+
+func TestHandleSignals_togglePause(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c := &Configuration{}
+	managers := []*Manager{NewWithContext(c, ctx), NewWithContext(c, ctx)}
+	managers[1].Pause()
+
+	handleSignals(ctx, managers)
+
+	// Services are resumed together if any is paused
+	if err := syscall.Kill(syscall.Getpid(), syscall.SIGUSR1); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, func() bool {
+		return !managers[0].Paused() && !managers[1].Paused()
+	})
+
+	// Without build history the rollback signal is only logged
+	if err := syscall.Kill(syscall.Getpid(), syscall.SIGUSR2); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := syscall.Kill(syscall.Getpid(), syscall.SIGUSR1); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, func() bool {
+		return managers[0].Paused() && managers[1].Paused()
+	})
+}
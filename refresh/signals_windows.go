@@ -0,0 +1,6 @@
+package refresh
+
+import "context"
+
+// handleSignals is a no-op, since Windows does not support user defined signals
+func handleSignals(context.Context, []*Manager) {}
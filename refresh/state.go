@@ -0,0 +1,284 @@
+package refresh
+
+import (
+	"fmt"
+)
+
+// States of a manager
+const (
+	StateIdle     = "idle"
+	StateBuilding = "building"
+	StateStarting = "starting"
+	StateRunning  = "running"
+	StateCrashed  = "crashed"
+)
+
+// Status is a snapshot of the state of a manager
+type Status struct {
+	Service   string          `json:"service,omitempty"`
+	State     string          `json:"state"`
+	Paused    bool            `json:"paused"`
+	LastBuild *BuildResult    `json:"lastBuild"`
+	Processes []ProcessStatus `json:"processes"`
+	// PausedChanges is the number of changed files recorded while paused or during a git operation
+	PausedChanges int `json:"pausedChanges"`
+	// GitOperation is the marker of a git operation in progress (e.g. rebase-merge), builds are held until it is finished
+	GitOperation string `json:"gitOperation,omitempty"`
+}
+
+// ProcessStatus is the state of a process of the app
+type ProcessStatus struct {
+	Name    string `json:"name,omitempty"`
+	PID     int    `json:"pid,omitempty"`
+	Running bool   `json:"running"`
+	Crashed bool   `json:"crashed"`
+}
+
+// State returns the current state of the manager: idle, building, starting, running or crashed
+func (r *Manager) State() string {
+	r.stateMx.Lock()
+	building, starting := r.building, r.starting
+	r.stateMx.Unlock()
+
+	switch {
+	case building:
+		return StateBuilding
+	case starting:
+		return StateStarting
+	}
+
+	running := len(r.processes) > 0
+	for _, p := range r.processStatus() {
+		if p.Crashed {
+			return StateCrashed
+		}
+		running = running && p.Running
+	}
+	if running {
+		return StateRunning
+	}
+	return StateIdle
+}
+
+// Status returns the state, the last build and the processes of the manager
+func (r *Manager) Status() Status {
+	r.stateMx.Lock()
+	paused, pausedChanges, gitOperation := r.paused, len(r.pausedEvents), r.gitOperation
+	r.stateMx.Unlock()
+
+	return Status{
+		Service:       r.Name,
+		State:         r.State(),
+		Paused:        paused,
+		PausedChanges: pausedChanges,
+		GitOperation:  gitOperation,
+		LastBuild:     r.LastBuild(),
+		Processes:     r.processStatus(),
+	}
+}
+
+func (r *Manager) processStatus() []ProcessStatus {
+	status := make([]ProcessStatus, 0, len(r.processes))
+	for _, p := range r.processes {
+		p.mu.Lock()
+		ps := ProcessStatus{
+			Name:    p.Name,
+			Running: p.running,
+			Crashed: p.crashed,
+		}
+		if p.running && p.cmd != nil && p.cmd.Process != nil {
+			ps.PID = p.cmd.Process.Pid
+		}
+		p.mu.Unlock()
+		status = append(status, ps)
+	}
+	return status
+}
+
+func (r *Manager) setBuilding(building bool) {
+	r.stateMx.Lock()
+	defer r.stateMx.Unlock()
+	r.building = building
+}
+
+func (r *Manager) setStarting(starting bool) {
+	r.stateMx.Lock()
+	defer r.stateMx.Unlock()
+	r.starting = starting
+}
+
+// Pause stops reacting to changes until Resume is called, the app keeps running.
+// Changes are recorded and handled with a single build on Resume.
+func (r *Manager) Pause() {
+	r.stateMx.Lock()
+	defer r.stateMx.Unlock()
+	if !r.paused {
+		r.logger().Info("Paused watching")
+	}
+	r.paused = true
+}
+
+// Resume reacts to changes again after Pause and builds once if anything changed while paused
+func (r *Manager) Resume() {
+	r.stateMx.Lock()
+	if !r.paused {
+		r.stateMx.Unlock()
+		return
+	}
+	r.paused = false
+	if op := r.gitOperation; op != "" {
+		r.stateMx.Unlock()
+		r.logger().
+			WithField("git", op).
+			Info("Resumed watching, holding builds until the git operation is finished")
+		return
+	}
+	events := r.pausedEvents
+	r.pausedEvents = nil
+	r.stateMx.Unlock()
+
+	r.logger().
+		WithField("changes", len(events)).
+		Info("Resumed watching")
+
+	r.handlePausedEvents(events)
+}
+
+// setGitOperation holds builds while a git operation is in progress (marked by op) and builds once when it is finished
+func (r *Manager) setGitOperation(op string) {
+	r.stateMx.Lock()
+	prev := r.gitOperation
+	r.gitOperation = op
+	if op != "" || prev == "" || r.paused {
+		r.stateMx.Unlock()
+		if op != "" && prev == "" {
+			// The index is locked briefly by many commands, e.g. git status of editors
+			logger := r.logger().WithField("git", op)
+			if op == "index.lock" {
+				logger.Debug("Holding builds during git operation")
+			} else {
+				logger.Info("Holding builds during git operation")
+			}
+		}
+		return
+	}
+	events := r.pausedEvents
+	r.pausedEvents = nil
+	r.stateMx.Unlock()
+
+	logger := r.logger().
+		WithField("git", prev).
+		WithField("changes", len(events))
+	if prev == "index.lock" && len(events) == 0 {
+		logger.Debug("Git operation finished")
+	} else {
+		logger.Info("Git operation finished")
+	}
+
+	r.handlePausedEvents(events)
+}
+
+// TogglePause pauses or resumes watching
+func (r *Manager) TogglePause() {
+	if r.Paused() {
+		r.Resume()
+	} else {
+		r.Pause()
+	}
+}
+
+// togglePause resumes all managers if any is paused and pauses them otherwise, so services are toggled together
+func togglePause(managers []*Manager) {
+	paused := false
+	for _, m := range managers {
+		paused = paused || m.Paused()
+	}
+	for _, m := range managers {
+		if paused {
+			m.Resume()
+		} else {
+			m.Pause()
+		}
+	}
+}
+
+// recordPausedEvent keeps the event for handling it on resume or after a git operation,
+// it returns false if builds are not held
+func (r *Manager) recordPausedEvent(event WatchEvent) bool {
+	r.stateMx.Lock()
+	defer r.stateMx.Unlock()
+	if !r.paused && r.gitOperation == "" {
+		return false
+	}
+	r.pausedEvents = appendEvent(r.pausedEvents, event)
+	return true
+}
+
+// handlePausedEvents requests a single build for the changes while paused,
+// or a single live reload if only files with the reload action changed
+func (r *Manager) handlePausedEvents(events []WatchEvent) {
+	var reloads []WatchEvent
+	build := false
+	for _, e := range events {
+		if e.Action == ActionReload {
+			reloads = append(reloads, e)
+			continue
+		}
+		// Pending events are collected for the next build, so all requests result in one build
+		r.requestBuild(e)
+		build = true
+	}
+
+	// A build restarts the app, which also reloads clients
+	if !build && len(reloads) > 0 {
+		r.setRestartCause(r.activeBuildID(), reloads, 0)
+		go r.notifyLiveReloadRestart()
+	}
+}
+
+// Paused checks if changes are ignored
+func (r *Manager) Paused() bool {
+	r.stateMx.Lock()
+	defer r.stateMx.Unlock()
+	return r.paused
+}
+
+// TriggerBuild requests a build like a change of a file, the app is restarted after a successful build
+func (r *Manager) TriggerBuild(trigger string) {
+	r.requestBuild(WatchEvent{Path: r.AppRoot, Type: trigger})
+}
+
+// TriggerRestart restarts the app on the current build. It returns once the restart is requested,
+// without waiting for the processes to be ready.
+func (r *Manager) TriggerRestart(trigger string) error {
+	r.logger().
+		WithField("trigger", trigger).
+		Info("Restarting...")
+	r.setRestartCause(r.activeBuildID(), []WatchEvent{{Path: r.AppRoot, Type: trigger}}, 0)
+
+	return r.requestRestart()
+}
+
+// requestRestart restarts the app without waiting for the runner, which might still be starting the processes.
+// A request while another one is pending is dropped, the pending restart covers it.
+func (r *Manager) requestRestart() error {
+	if r.context.Err() != nil {
+		return fmt.Errorf("manager is stopped")
+	}
+	if !r.restartPending.CompareAndSwap(false, true) {
+		return nil
+	}
+	go func() {
+		defer r.restartPending.Store(false)
+		select {
+		case r.Restart <- true:
+		case <-r.context.Done():
+		}
+	}()
+	return nil
+}
+
+// Stop stops the processes and the manager
+func (r *Manager) Stop() {
+	r.cancelFunc()
+}
@@ -0,0 +1,84 @@
+package refresh
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestManager_pauseResume(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	r := NewWithContext(&Configuration{}, ctx)
+
+	if r.recordPausedEvent(WatchEvent{Path: "main.go"}) {
+		t.Fatal("event recorded while not paused")
+	}
+
+	r.Pause()
+	for _, e := range []WatchEvent{
+		{Path: "main.go", Type: "create"},
+		{Path: "handler.go", Type: "write"},
+		{Path: "main.go", Type: "write"},
+		{Path: "templates/index.html", Action: ActionReload},
+	} {
+		if !r.recordPausedEvent(e) {
+			t.Fatalf("event %s not recorded while paused", e.Path)
+		}
+	}
+	if got := r.Status().PausedChanges; got != 3 {
+		t.Errorf("paused changes = %d, want 3", got)
+	}
+	if len(r.buildRequests) != 0 {
+		t.Fatal("build requested while paused")
+	}
+
+	r.Resume()
+	if r.Paused() {
+		t.Error("still paused after resume")
+	}
+	if len(r.buildRequests) != 1 {
+		t.Fatalf("build requests after resume = %d, want 1", len(r.buildRequests))
+	}
+	// The reload is covered by the restart after the build
+	want := []WatchEvent{
+		{Path: "handler.go", Type: "write"},
+		{Path: "main.go", Type: "write"},
+	}
+	if got := r.takePendingEvents(); !reflect.DeepEqual(got, want) {
+		t.Errorf("pending events = %v, want %v", got, want)
+	}
+}
+
+func TestManager_setGitOperation(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	r := NewWithContext(&Configuration{}, ctx)
+
+	r.setGitOperation("rebase-merge")
+	if !r.recordPausedEvent(WatchEvent{Path: "main.go", Type: "write"}) {
+		t.Fatal("event not recorded during git operation")
+	}
+
+	// Resuming during a git operation keeps holding builds
+	r.Pause()
+	r.Resume()
+	if len(r.buildRequests) != 0 {
+		t.Fatal("build requested during git operation")
+	}
+
+	// Builds stay held after the git operation while paused
+	r.Pause()
+	r.setGitOperation("")
+	if len(r.buildRequests) != 0 {
+		t.Fatal("build requested while paused")
+	}
+
+	r.Resume()
+	if len(r.buildRequests) != 1 {
+		t.Fatalf("build requests after resume = %d, want 1", len(r.buildRequests))
+	}
+	if got := r.takePendingEvents(); len(got) != 1 || got[0].Path != "main.go" {
+		t.Errorf("pending events = %v, want main.go", got)
+	}
+}
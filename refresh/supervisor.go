@@ -0,0 +1,129 @@
+package refresh
+
+import (
+	"context"
+	"errors"
+
+	"github.com/apex/log"
+)
+
+// Supervisor runs a manager for every service of the configuration.
+// All services share one watcher and one live reload server, but a change only
+// rebuilds the services whose build target depends on the changed package.
+type Supervisor struct {
+	*Configuration
+	Managers   []*Manager
+	cancelFunc context.CancelFunc
+	context    context.Context
+}
+
+func NewSupervisorWithContext(c *Configuration, ctx context.Context) (*Supervisor, error) {
+	ctx, cancelFunc := context.WithCancel(ctx)
+	s := &Supervisor{
+		Configuration: c,
+		cancelFunc:    cancelFunc,
+		context:       ctx,
+	}
+
+	if err := c.validateServices(); err != nil {
+		cancelFunc()
+		return nil, err
+	}
+
+	for _, svc := range c.Services {
+		m := NewWithContext(c.ServiceConfiguration(svc), ctx)
+		m.Name = svc.Name
+		m.affectedOnly = true
+		s.Managers = append(s.Managers, m)
+	}
+
+	return s, nil
+}
+
+func (s *Supervisor) Start() error {
+	defer s.cancelFunc()
+
+	w := newWatcher(s.context, s.Configuration)
+	err := w.Start()
+	if err != nil {
+		return err
+	}
+
+	shutdownControl, err := startControlServer(s.Configuration, s.Managers, s.cancelFunc)
+	if err != nil {
+		return err
+	}
+	defer shutdownControl()
+
+	shutdownKeyboard, err := startKeyboard(s.Configuration, s.Managers, s.cancelFunc)
+	if err != nil {
+		return err
+	}
+	defer shutdownKeyboard()
+
+	watchGitOperations(s.context, s.Configuration, s.Managers)
+	handleSignals(s.context, s.Managers)
+
+	var liveReload *liveReloadServer
+	if s.LiveReload {
+		liveReload, err = newLiveReloadServer(s.context, s.Configuration)
+		if err != nil {
+			return err
+		}
+	}
+
+	errs := make(chan error, len(s.Managers))
+	events := make([]chan WatchEvent, len(s.Managers))
+	for i, m := range s.Managers {
+		m.liveReload = liveReload
+		events[i] = make(chan WatchEvent, 1)
+		go func(m *Manager, events <-chan WatchEvent) {
+			errs <- m.run(events)
+		}(m, events[i])
+	}
+
+	log.Debugf("Started %d services", len(s.Managers))
+
+	go s.fanOut(w.Events, events, liveReload)
+
+	// Stop all services if one of them fails, a service without anything to build only stops itself
+	var firstErr error
+	for range s.Managers {
+		err := <-errs
+		if err == nil {
+			continue
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+		if !errors.Is(err, errUnableToBuild) {
+			s.cancelFunc()
+		}
+	}
+	return firstErr
+}
+
+// fanOut sends watch events to all managers, they decide if the change is relevant
+func (s *Supervisor) fanOut(watchEvents <-chan WatchEvent, events []chan WatchEvent, liveReload *liveReloadServer) {
+	for {
+		select {
+		case event := <-watchEvents:
+			// Assets are swapped once for all services
+			if event.Action == ActionReload && event.Asset != "" && liveReload != nil {
+				liveReload.publishAsset(s.AppRoot, event)
+				continue
+			}
+			for i, c := range events {
+				select {
+				case c <- event:
+				case <-s.Managers[i].context.Done():
+					// The service was stopped
+				case <-s.context.Done():
+					return
+				}
+			}
+		case <-s.context.Done():
+			return
+		}
+	}
+}
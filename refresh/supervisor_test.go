@@ -0,0 +1,107 @@
+package refresh
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestNewSupervisorWithContext(t *testing.T) {
+	tests := []struct {
+		name      string
+		services  []Service
+		wantErr   string
+		wantNames []string
+	}{
+		{
+			name:      "one manager per service",
+			services:  []Service{{Name: "api"}, {Name: "worker"}},
+			wantNames: []string{"api", "worker"},
+		},
+		{
+			name:     "missing name",
+			services: []Service{{Name: "api"}, {BuildTargetPath: "./cmd/worker"}},
+			wantErr:  "service 1: missing name",
+		},
+		{
+			name:     "duplicate name",
+			services: []Service{{Name: "api"}, {Name: "worker"}, {Name: "api"}},
+			wantErr:  `service "api": duplicate name`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := NewSupervisorWithContext(&Configuration{Services: tt.services}, context.Background())
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer s.cancelFunc()
+
+			if len(s.Managers) != len(tt.wantNames) {
+				t.Fatalf("got %d managers, want %d", len(s.Managers), len(tt.wantNames))
+			}
+			for i, m := range s.Managers {
+				if m.Name != tt.wantNames[i] {
+					t.Errorf("manager %d name = %q, want %q", i, m.Name, tt.wantNames[i])
+				}
+				if m.BinaryName != tt.wantNames[i] {
+					t.Errorf("manager %d binary name = %q, want %q", i, m.BinaryName, tt.wantNames[i])
+				}
+				if !m.affectedOnly {
+					t.Errorf("manager %d rebuilds on every change", i)
+				}
+			}
+		})
+	}
+}
+
+func TestSupervisor_fanOut(t *testing.T) {
+	s, err := NewSupervisorWithContext(&Configuration{
+		Services: []Service{{Name: "api"}, {Name: "worker"}, {Name: "admin"}},
+	}, context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	watchEvents := make(chan WatchEvent)
+	events := make([]chan WatchEvent, len(s.Managers))
+	for i := range events {
+		events[i] = make(chan WatchEvent, 1)
+	}
+	done := make(chan struct{})
+	go func() {
+		s.fanOut(watchEvents, events, nil)
+		close(done)
+	}()
+
+	// A stopped service must not block the others
+	s.Managers[1].Stop()
+
+	for _, path := range []string{"main.go", "handler.go"} {
+		watchEvents <- WatchEvent{Path: path}
+		for _, i := range []int{0, 2} {
+			select {
+			case e := <-events[i]:
+				if e.Path != path {
+					t.Errorf("service %s received %s, want %s", s.Managers[i].Name, e.Path, path)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatalf("service %s did not receive %s", s.Managers[i].Name, path)
+			}
+		}
+	}
+
+	s.cancelFunc()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("fan out did not return after the supervisor was stopped")
+	}
+}
@@ -0,0 +1,9 @@
+//go:build !(darwin || dragonfly || freebsd || linux || netbsd || openbsd)
+
+package refresh
+
+import "errors"
+
+func makeCbreak(fd int) (restore func() error, err error) {
+	return nil, errors.New("keyboard shortcuts are not supported on this platform")
+}
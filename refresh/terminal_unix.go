@@ -0,0 +1,34 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+
+package refresh
+
+import (
+	"errors"
+
+	"golang.org/x/sys/unix"
+)
+
+// makeCbreak disables line buffering and echo of the terminal, so single key presses can be read.
+// Unlike raw mode, signals (Ctrl-C) and output processing stay enabled.
+func makeCbreak(fd int) (restore func() error, err error) {
+	t, err := unix.IoctlGetTermios(fd, ioctlGetTermios)
+	if errors.Is(err, unix.ENOTTY) {
+		return nil, errors.New("stdin is not a terminal")
+	}
+	if err != nil {
+		return nil, err
+	}
+	old := *t
+
+	t.Lflag &^= unix.ICANON | unix.ECHO
+	t.Cc[unix.VMIN] = 1
+	t.Cc[unix.VTIME] = 0
+	err = unix.IoctlSetTermios(fd, ioctlSetTermios, t)
+	if err != nil {
+		return nil, err
+	}
+
+	return func() error {
+		return unix.IoctlSetTermios(fd, ioctlSetTermios, &old)
+	}, nil
+}
@@ -0,0 +1,238 @@
+package refresh
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/apex/log"
+)
+
+const (
+	devCACertFile = "dev-ca.pem"
+	devCAKeyFile  = "dev-ca-key.pem"
+
+	devCAValidity   = 10 * 365 * 24 * time.Hour
+	devCertValidity = 30 * 24 * time.Hour
+)
+
+// liveReloadTLS returns the TLS configuration of the live reload server or nil if TLS is disabled.
+// A configured certificate and key are used as is, otherwise a certificate for the hosts of the server
+// is issued by the development CA.
+func (c *Configuration) liveReloadTLS(addr *net.TCPAddr) (*tls.Config, error) {
+	if c.LiveReloadTLSCert != "" || c.LiveReloadTLSKey != "" {
+		cert, err := tls.LoadX509KeyPair(c.LiveReloadTLSCert, c.LiveReloadTLSKey)
+		if err != nil {
+			return nil, fmt.Errorf("loading live reload TLS certificate: %w", err)
+		}
+		return &tls.Config{Certificates: []tls.Certificate{cert}}, nil
+	}
+
+	if !c.LiveReloadTLS {
+		return nil, nil
+	}
+
+	hosts := []string{"localhost", "127.0.0.1", "::1"}
+	if addr.IP == nil || addr.IP.IsUnspecified() {
+		// The server is reachable on all interfaces, e.g. from other devices on the LAN
+		hosts = append(hosts, interfaceIPs()...)
+	} else {
+		hosts = append(hosts, addr.IP.String())
+	}
+	if u, err := url.Parse(c.LiveReloadURL); err == nil && u.Hostname() != "" {
+		hosts = append(hosts, u.Hostname())
+	}
+	if hostname, err := os.Hostname(); err == nil {
+		hosts = append(hosts, hostname)
+	}
+
+	cert, err := devCertificate(hosts)
+	if err != nil {
+		return nil, fmt.Errorf("issuing live reload TLS certificate: %w", err)
+	}
+	return &tls.Config{Certificates: []tls.Certificate{cert}}, nil
+}
+
+// interfaceIPs returns the IP addresses of the network interfaces
+func interfaceIPs() []string {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		log.WithError(err).Warn("liveReload: Failed to get interface addresses")
+		return nil
+	}
+	var ips []string
+	for _, a := range addrs {
+		if ipNet, ok := a.(*net.IPNet); ok && !ipNet.IP.IsLinkLocalUnicast() {
+			ips = append(ips, ipNet.IP.String())
+		}
+	}
+	return ips
+}
+
+// DevCAPath returns the path of the development CA certificate in the user cache dir
+func DevCAPath() (string, error) {
+	dir, err := devCADir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, devCACertFile), nil
+}
+
+// DevCA returns the PEM encoded development CA certificate, it is created if it does not exist yet
+func DevCA() ([]byte, error) {
+	_, _, err := loadOrCreateDevCA()
+	if err != nil {
+		return nil, err
+	}
+	path, err := DevCAPath()
+	if err != nil {
+		return nil, err
+	}
+	return os.ReadFile(path)
+}
+
+func devCADir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("getting user cache dir: %w", err)
+	}
+	return filepath.Join(dir, "refresh"), nil
+}
+
+// loadOrCreateDevCA loads the development CA from the user cache dir or generates a new one
+func loadOrCreateDevCA() (*x509.Certificate, crypto.Signer, error) {
+	dir, err := devCADir()
+	if err != nil {
+		return nil, nil, err
+	}
+	certPath := filepath.Join(dir, devCACertFile)
+	keyPath := filepath.Join(dir, devCAKeyFile)
+
+	pair, err := tls.LoadX509KeyPair(certPath, keyPath)
+	if err == nil {
+		cert, err := x509.ParseCertificate(pair.Certificate[0])
+		if err != nil {
+			return nil, nil, fmt.Errorf("parsing development CA: %w", err)
+		}
+		if time.Now().Before(cert.NotAfter) {
+			return cert, pair.PrivateKey.(crypto.Signer), nil
+		}
+		log.Warn("Development CA expired, generating a new one")
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, nil, fmt.Errorf("loading development CA: %w", err)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	hostname, _ := os.Hostname()
+	tmpl := &x509.Certificate{
+		SerialNumber: randomSerial(),
+		Subject: pkix.Name{
+			Organization: []string{"refresh development CA"},
+			CommonName:   "refresh development CA " + hostname,
+		},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(devCAValidity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, key.Public(), key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("creating development CA: %w", err)
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = os.MkdirAll(dir, 0700)
+	if err != nil {
+		return nil, nil, fmt.Errorf("creating development CA dir: %w", err)
+	}
+	err = os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0600)
+	if err != nil {
+		return nil, nil, fmt.Errorf("writing development CA key: %w", err)
+	}
+	err = os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644)
+	if err != nil {
+		return nil, nil, fmt.Errorf("writing development CA: %w", err)
+	}
+
+	log.Infof("Generated development CA %s, run `refresh ca` for trusting it", certPath)
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, nil, err
+	}
+	return cert, key, nil
+}
+
+// devCertificate issues a server certificate for the hosts by the development CA
+func devCertificate(hosts []string) (tls.Certificate, error) {
+	ca, caKey, err := loadOrCreateDevCA()
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: randomSerial(),
+		Subject: pkix.Name{
+			Organization: []string{"refresh development certificate"},
+		},
+		NotBefore:   time.Now().Add(-time.Hour),
+		NotAfter:    time.Now().Add(devCertValidity),
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	seen := make(map[string]struct{}, len(hosts))
+	for _, h := range hosts {
+		if _, ok := seen[h]; ok || h == "" {
+			continue
+		}
+		seen[h] = struct{}{}
+		if ip := net.ParseIP(h); ip != nil {
+			tmpl.IPAddresses = append(tmpl.IPAddresses, ip)
+		} else {
+			tmpl.DNSNames = append(tmpl.DNSNames, h)
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca, key.Public(), caKey)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	return tls.Certificate{
+		Certificate: [][]byte{der, ca.Raw},
+		PrivateKey:  key,
+	}, nil
+}
+
+func randomSerial() *big.Int {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		// The system random source failing is not recoverable
+		panic(err)
+	}
+	return serial
+}
@@ -0,0 +1,80 @@
+package refresh
+
+import (
+	"crypto/x509"
+	"net"
+	"testing"
+)
+
+func TestDevCertificate(t *testing.T) {
+	// The development CA is stored in the user cache dir
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+
+	cert, err := devCertificate([]string{"localhost", "127.0.0.1", "devbox.local", "localhost", ""})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cert.Certificate) != 2 {
+		t.Fatalf("certificate chain has %d certificates, want 2", len(cert.Certificate))
+	}
+
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, err := x509.ParseCertificate(cert.Certificate[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+	for _, host := range []string{"localhost", "127.0.0.1", "devbox.local"} {
+		if _, err := leaf.Verify(x509.VerifyOptions{DNSName: host, Roots: roots}); err != nil {
+			t.Errorf("verifying certificate for %s: %v", host, err)
+		}
+	}
+	if len(leaf.DNSNames) != 2 || len(leaf.IPAddresses) != 1 {
+		t.Errorf("certificate has DNS names %v and IPs %v, want duplicates and empty hosts removed", leaf.DNSNames, leaf.IPAddresses)
+	}
+
+	// The CA is reused for the next certificate
+	next, err := devCertificate([]string{"localhost"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(next.Certificate[1]) != string(cert.Certificate[1]) {
+		t.Error("development CA was not reused")
+	}
+}
+
+func TestConfiguration_liveReloadTLS(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+
+	c := &Configuration{}
+	tlsConfig, err := c.liveReloadTLS(&net.TCPAddr{IP: net.IPv4zero})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tlsConfig != nil {
+		t.Fatal("TLS enabled without configuration")
+	}
+
+	c.LiveReloadTLS = true
+	tlsConfig, err = c.liveReloadTLS(&net.TCPAddr{IP: net.IPv4zero})
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(tlsConfig.Certificates[0].Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	// All interfaces are included for an unspecified address, at least the loopback interface
+	for _, ip := range interfaceIPs() {
+		if err := leaf.VerifyHostname(ip); err != nil {
+			t.Errorf("certificate is not valid for interface IP %s: %v", ip, err)
+		}
+	}
+}
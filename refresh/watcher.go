@@ -3,13 +3,23 @@ package refresh
 import (
 	"context"
 	"fmt"
+	"io/fs"
+	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 
 	"github.com/apex/log"
 	"github.com/rjeczalik/notify"
 )
 
+// Actions of watch roots on changes
+const (
+	ActionBuild   = "build"
+	ActionRestart = "restart"
+	ActionReload  = "reload"
+)
+
 type Watcher struct {
 	ctx                context.Context
 	Events             chan WatchEvent
@@ -17,11 +27,60 @@ type Watcher struct {
 	includedExtensions []string
 	includedPatterns   []string
 	ignoredFolders     []string
+	roots              []WatchRoot
+	ignoredEvents      []string
+	attribEvents       bool
+	eventMask          notify.Event
+	contents           *contentCache
+	trackModules       bool
+
+	mu         sync.Mutex
+	appPath    string
+	extraRoots map[string]func()
+	// moduleUpdates requests an update of the local modules, it is buffered so changes during an update are coalesced
+	moduleUpdates chan struct{}
 }
 
 type WatchEvent struct {
 	Path string
 	Type string
+	// Action of the watch root, empty for the app root
+	Action string
+	// Asset is the type of a file that can be swapped in the browser without a reload (css or image)
+	Asset string
+}
+
+// Types of assets that are hot swapped by live reload
+const (
+	AssetCSS   = "css"
+	AssetImage = "image"
+)
+
+var assetTypes = map[string]string{
+	".css":  AssetCSS,
+	".png":  AssetImage,
+	".jpg":  AssetImage,
+	".jpeg": AssetImage,
+	".gif":  AssetImage,
+	".svg":  AssetImage,
+	".webp": AssetImage,
+	".avif": AssetImage,
+	".ico":  AssetImage,
+}
+
+// watchedPath is a resolved watch root
+type watchedPath struct {
+	WatchRoot
+	// dir is the absolute directory that is watched
+	dir string
+	// file is the name of the file if only a single file is watched
+	file string
+	// matchAll is set for explicit roots without extensions and patterns
+	matchAll bool
+	// excluded are explicit roots inside the app root, their files are only handled by their own action
+	excluded []watchedPath
+	// modules passes changes of go.mod and go.work regardless of the filters
+	modules bool
 }
 
 func NewWatcher(ctx context.Context, appRoot string, includedExtensions []string, includedPatterns []string, ignoredFolders []string) *Watcher {
@@ -36,15 +95,125 @@ func NewWatcher(ctx context.Context, appRoot string, includedExtensions []string
 	}
 }
 
+// AddRoot adds an additional path to watch with its own filters and action, it must be called before Start.
+func (w *Watcher) AddRoot(root WatchRoot) {
+	w.roots = append(w.roots, root)
+}
+
+// IgnoreEvents sets the event types that are not watched (create, remove, write, rename or chmod), it must be called before Start.
+func (w *Watcher) IgnoreEvents(types []string) {
+	w.ignoredEvents = types
+}
+
+// WatchAttribEvents also watches changes of permissions, ownership and other metadata, it must be called before Start.
+func (w *Watcher) WatchAttribEvents() {
+	w.attribEvents = true
+}
+
+// DeduplicateEvents drops events for files whose content did not change, it must be called before Start.
+func (w *Watcher) DeduplicateEvents() {
+	w.contents = newContentCache(contentCacheSize)
+}
+
+// TrackModuleFiles passes changes of go.mod and go.work regardless of the filters, since they change the
+// dependencies of the build target. It must be called before Start.
+func (w *Watcher) TrackModuleFiles() {
+	w.trackModules = true
+}
+
+// eventTypes are the names of event types for ignored_events. Attribute changes are watched with the platform event
+// if enabled, since they are not part of notify.All.
+var eventTypes = map[string]notify.Event{
+	"create": notify.Create,
+	"remove": notify.Remove,
+	"write":  notify.Write,
+	"rename": notify.Rename,
+	"chmod":  attribEvent,
+	"attrib": attribEvent,
+}
+
+// eventMask returns the watched events without the ignored event types
+func eventMask(ignoredEvents []string, attrib bool) (notify.Event, error) {
+	mask := notify.All
+	if attrib {
+		mask |= attribEvent
+	}
+	for _, t := range ignoredEvents {
+		e, ok := eventTypes[strings.ToLower(strings.TrimSpace(t))]
+		if !ok {
+			return 0, fmt.Errorf("invalid ignored event type %q", t)
+		}
+		mask &^= e
+	}
+	if mask == 0 {
+		return 0, fmt.Errorf("all event types are ignored")
+	}
+	return mask, nil
+}
+
 func (w *Watcher) Start() error {
 	appPath, err := filepath.Abs(w.appRoot)
 	if err != nil {
 		return fmt.Errorf("getting absolute app root path: %w", err)
 	}
 
+	w.eventMask, err = eventMask(w.ignoredEvents, w.attribEvents)
+	if err != nil {
+		return err
+	}
+
 	// Validate included patterns once up front, so a malformed glob surfaces
 	// immediately instead of silently never matching in the event loop.
-	for _, p := range w.includedPatterns {
+	validatePatterns(w.includedPatterns)
+	for _, root := range w.roots {
+		validatePatterns(root.IncludedPatterns)
+	}
+
+	w.appPath = appPath
+	appWatch := w.defaultPath(appPath)
+
+	roots := make([]watchedPath, 0, len(w.roots))
+	for _, root := range w.roots {
+		wp, err := w.resolveRoot(root)
+		if err != nil {
+			return err
+		}
+		if isWithin(appPath, wp.dir) {
+			appWatch.excluded = append(appWatch.excluded, wp)
+		}
+		roots = append(roots, wp)
+	}
+
+	// Events of the watched paths request module updates
+	w.moduleUpdates = make(chan struct{}, 1)
+
+	_, err = w.watchPath(appWatch)
+	if err != nil {
+		return fmt.Errorf("watching app root recursively: %w", err)
+	}
+
+	watched := []watchedPath{appWatch}
+	for _, wp := range roots {
+		_, err = w.watchPath(wp)
+		if err != nil {
+			return fmt.Errorf("watching %s: %w", wp.Path, err)
+		}
+		log.Debugf("Watching %s (action %s)", wp.Path, wp.Action)
+		watched = append(watched, wp)
+	}
+
+	w.updateModuleRoots()
+	go w.trackModuleRoots()
+
+	if w.contents != nil {
+		go w.primeContents(watched)
+	}
+
+	return nil
+}
+
+func validatePatterns(patterns []string) {
+	for _, p := range patterns {
 		p = strings.TrimSpace(p)
 		if p == "" {
 			continue
@@ -53,60 +222,298 @@ func (w *Watcher) Start() error {
 			log.Warnf("Invalid included_patterns entry %q: %v (it will never match)", p, err)
 		}
 	}
+}
+
+// defaultPath watches a directory recursively with the filters of the watcher
+func (w *Watcher) defaultPath(dir string) watchedPath {
+	return watchedPath{
+		WatchRoot: WatchRoot{
+			Path:               dir,
+			Recursive:          true,
+			IncludedExtensions: w.includedExtensions,
+			IncludedPatterns:   w.includedPatterns,
+			IgnoredFolders:     w.ignoredFolders,
+		},
+		dir:     dir,
+		modules: w.trackModules,
+	}
+}
+
+// resolveRoot resolves the path of an explicit root relative to the app root
+func (w *Watcher) resolveRoot(root WatchRoot) (watchedPath, error) {
+	path := root.Path
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(w.appPath, path)
+	}
+	path = filepath.Clean(path)
+
+	if root.Action == "" {
+		root.Action = ActionBuild
+	}
+	switch root.Action {
+	case ActionBuild, ActionRestart, ActionReload:
+	default:
+		return watchedPath{}, fmt.Errorf("watch %s: invalid action %q", root.Path, root.Action)
+	}
+
+	wp := watchedPath{
+		WatchRoot: root,
+		dir:       path,
+		matchAll:  len(root.IncludedExtensions) == 0 && len(root.IncludedPatterns) == 0,
+	}
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		return watchedPath{}, fmt.Errorf("watch %s: %w", root.Path, err)
+	}
+	// A single file is watched via its directory, so it is still found after editors replaced it
+	if !fi.IsDir() {
+		wp.dir = filepath.Dir(path)
+		wp.file = filepath.Base(path)
+		wp.Recursive = false
+	}
 
+	return wp, nil
+}
+
+// watchPath watches the path and sends events for watched files until the returned function is called
+func (w *Watcher) watchPath(wp watchedPath) (stop func(), err error) {
 	c := make(chan notify.EventInfo, 100)
-	err = notify.Watch(filepath.Join(w.appRoot, "..."), c, notify.All)
+	target := wp.dir
+	if wp.Recursive {
+		target = filepath.Join(target, "...")
+	}
+	err = notify.Watch(target, c, w.eventMask)
 	if err != nil {
-		return fmt.Errorf("watching app root recursively: %w", err)
+		return nil, err
 	}
+	stopped := make(chan struct{})
 	go func() {
 		defer notify.Stop(c)
 		for {
 			select {
 			case evt := <-c:
 				path := evt.Path()
-				if w.isIgnoredFolder(appPath, path) {
-					log.Debugf("Ignoring change in %s (ignored folder)", path)
+				// Local modules are tracked, even if module files are not watched
+				if wp.Action == "" && isModuleFile(path) && !isIgnoredFolder(wp.IgnoredFolders, wp.dir, path) {
+					w.requestModuleRoots()
+				}
+				if reason := wp.filter(path); reason != "" {
+					log.Debugf("Ignoring change in %s (%s)", path, reason)
 					continue
 				}
-				if !w.isWatchedFile(path) {
-					log.Debugf("Ignoring change in %s (not watched file)", path)
+				if w.contents != nil && !w.contents.changed(path) {
+					log.Debugf("Ignoring change in %s (content unchanged)", path)
 					continue
 				}
-				w.Events <- WatchEvent{
-					Path: evt.Path(),
-					Type: evt.Event().String(),
+				select {
+				case w.Events <- WatchEvent{
+					Path:   evt.Path(),
+					Type:   evt.Event().String(),
+					Action: wp.Action,
+					Asset:  assetType(path),
+				}:
+				case <-w.ctx.Done():
+					return
 				}
+			case <-stopped:
+				return
 			case <-w.ctx.Done():
 				return
 			}
 		}
 	}()
-	return nil
+	return func() { close(stopped) }, nil
+}
+
+// filter returns the reason why a change of the path is ignored or an empty string if it is watched
+func (wp watchedPath) filter(path string) string {
+	if wp.file != "" {
+		if filepath.Base(path) != wp.file {
+			return "not watched file"
+		}
+		return ""
+	}
+	if isIgnoredFolder(wp.IgnoredFolders, wp.dir, path) {
+		return "ignored folder"
+	}
+	for _, root := range wp.excluded {
+		if root.covers(path) {
+			return "handled by watch root " + root.Path
+		}
+	}
+	// Module files change the dependencies of the build target, but not the action of explicit roots with filters
+	if wp.modules && wp.Action == "" && isModuleFile(path) {
+		return ""
+	}
+	if !wp.matchAll && !isWatchedFile(wp.IncludedExtensions, wp.IncludedPatterns, path) {
+		return "not watched file"
+	}
+	return ""
+}
+
+// covers checks if a change of the path is handled by the root
+func (wp watchedPath) covers(path string) bool {
+	switch {
+	case wp.file != "":
+		if path != filepath.Join(wp.dir, wp.file) {
+			return false
+		}
+	case wp.Recursive:
+		if !isWithin(wp.dir, path) {
+			return false
+		}
+	default:
+		if filepath.Dir(path) != wp.dir {
+			return false
+		}
+	}
+	return wp.filter(path) == ""
+}
+
+// isWithin checks if path is dir or inside of it
+func isWithin(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// primeContents hashes the watched files, so a first event without a content change can already be dropped
+func (w *Watcher) primeContents(watched []watchedPath) {
+	for _, wp := range watched {
+		if wp.file != "" {
+			w.contents.prime(filepath.Join(wp.dir, wp.file))
+			continue
+		}
+		err := filepath.WalkDir(wp.dir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return nil
+			}
+			if w.ctx.Err() != nil {
+				return w.ctx.Err()
+			}
+			if d.IsDir() {
+				if path != wp.dir && (!wp.Recursive || d.Name() == ".git" || isIgnoredFolder(wp.IgnoredFolders, wp.dir, path)) {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if wp.filter(path) != "" {
+				return nil
+			}
+			if !w.contents.prime(path) {
+				return fs.SkipAll
+			}
+			return nil
+		})
+		if err != nil {
+			return
+		}
+	}
+	log.Debug("Primed content hashes of watched files")
+}
+
+// requestModuleRoots requests an update of the local modules without blocking the event loop
+func (w *Watcher) requestModuleRoots() {
+	select {
+	case w.moduleUpdates <- struct{}{}:
+	default:
+		// An update is already pending
+	}
+}
+
+// trackModuleRoots updates the local modules on request, since reading them calls the go tool
+func (w *Watcher) trackModuleRoots() {
+	for {
+		select {
+		case <-w.moduleUpdates:
+			w.updateModuleRoots()
+		case <-w.ctx.Done():
+			return
+		}
+	}
 }
 
-func (w Watcher) isIgnoredFolder(appPath, path string) bool {
-	for _, e := range w.ignoredFolders {
-		if strings.HasPrefix(path, filepath.Join(appPath, e, "")) {
+// updateModuleRoots watches local modules outside of the app root, that are used via replace directives or a workspace
+func (w *Watcher) updateModuleRoots() {
+	dirs, err := localModuleDirs(w.ctx, w.appRoot)
+	if err != nil {
+		log.WithError(err).Warn("Failed to read local modules from go.mod / go.work")
+		return
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	appDir := realDir(w.appPath)
+	roots := make(map[string]struct{}, len(dirs))
+	for _, dir := range dirs {
+		// Modules inside the app root are already watched
+		if isWithin(appDir, dir) {
+			continue
+		}
+		roots[dir] = struct{}{}
+	}
+
+	for root, stop := range w.extraRoots {
+		if _, ok := roots[root]; !ok {
+			stop()
+			delete(w.extraRoots, root)
+			log.Debugf("Stopped watching local module %s", root)
+		}
+	}
+
+	if w.extraRoots == nil {
+		w.extraRoots = make(map[string]func())
+	}
+	for root := range roots {
+		if _, ok := w.extraRoots[root]; ok {
+			continue
+		}
+		stop, err := w.watchPath(w.defaultPath(root))
+		if err != nil {
+			log.WithError(err).Warnf("Failed to watch local module %s", root)
+			continue
+		}
+		w.extraRoots[root] = stop
+		log.Infof("Watching local module %s", root)
+	}
+}
+
+// assetType returns the asset type of the file or an empty string if it is not an asset
+func assetType(path string) string {
+	return assetTypes[strings.ToLower(filepath.Ext(path))]
+}
+
+func isIgnoredFolder(ignoredFolders []string, root, path string) bool {
+	// Changes in the git dir are never relevant, git operations are handled by git_pause
+	if rel, err := filepath.Rel(root, path); err == nil {
+		for _, part := range strings.Split(rel, string(filepath.Separator)) {
+			if part == ".git" {
+				return true
+			}
+		}
+	}
+	for _, e := range ignoredFolders {
+		if strings.HasPrefix(path, filepath.Join(root, e, "")) {
 			return true
 		}
 	}
 	return false
 }
 
-func (w Watcher) isWatchedFile(path string) bool {
+func isWatchedFile(includedExtensions, includedPatterns []string, path string) bool {
 	base := filepath.Base(path)
 	ext := filepath.Ext(path)
 
 	// Exact match on the last extension (unchanged, backwards compatible).
-	for _, e := range w.includedExtensions {
+	for _, e := range includedExtensions {
 		if strings.TrimSpace(e) == ext {
 			return true
 		}
 	}
 
 	// Glob match on the file name (e.g. ".env*" to catch a whole family of files).
-	for _, p := range w.includedPatterns {
+	for _, p := range includedPatterns {
 		p = strings.TrimSpace(p)
 		if p == "" {
 			continue
@@ -0,0 +1,69 @@
+//go:build linux
+
+package refresh
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWatcher_IgnoreEvents(t *testing.T) {
+	tests := []struct {
+		name      string
+		ignored   []string
+		attrib    bool
+		wantEvent bool
+	}{
+		{
+			name: "chmod is not watched by default",
+		},
+		{
+			name:      "chmod is watched with attribute changes",
+			attrib:    true,
+			wantEvent: true,
+		},
+		{
+			name:    "chmod is ignored",
+			ignored: []string{"chmod"},
+			attrib:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, "main.go")
+			writeFile(t, path, "package main")
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			w := NewWatcher(ctx, dir, []string{".go"}, nil, nil)
+			w.IgnoreEvents(tt.ignored)
+			if tt.attrib {
+				w.WatchAttribEvents()
+			}
+			if err := w.Start(); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := os.Chmod(path, 0600); err != nil {
+				t.Fatal(err)
+			}
+
+			select {
+			case e := <-w.Events:
+				if !tt.wantEvent {
+					t.Errorf("unexpected event %s for %s", e.Type, e.Path)
+				}
+			case <-time.After(500 * time.Millisecond):
+				if tt.wantEvent {
+					t.Error("expected an event for chmod")
+				}
+			}
+		})
+	}
+}
@@ -1,12 +1,19 @@
 package refresh
 
-import "testing"
+import (
+	"os"
+	"path/filepath"
+	"testing"
 
-func TestWatcher_isWatchedFile(t *testing.T) {
+	"github.com/rjeczalik/notify"
+)
+
+func TestWatcher_filter(t *testing.T) {
 	tests := []struct {
 		name               string
 		includedExtensions []string
 		includedPatterns   []string
+		trackModules       bool
 		path               string
 		want               bool
 	}{
@@ -103,6 +110,33 @@ func TestWatcher_isWatchedFile(t *testing.T) {
 			want:               false,
 		},
 
+		// Module files.
+		{
+			name:               "go.mod is not watched by default",
+			includedExtensions: []string{".go"},
+			path:               "go.mod",
+			want:               false,
+		},
+		{
+			name:               "go.mod is watched by included extensions",
+			includedExtensions: []string{".go", ".mod"},
+			path:               "go.mod",
+			want:               true,
+		},
+		{
+			name:         "go.mod is watched when tracking modules",
+			trackModules: true,
+			path:         "go.mod",
+			want:         true,
+		},
+		{
+			name:               "go.work is watched when tracking modules",
+			includedExtensions: []string{".go"},
+			trackModules:       true,
+			path:               "go.work",
+			want:               true,
+		},
+
 		// Robustness.
 		{
 			name:             "empty pattern entry does not match everything",
@@ -128,9 +162,282 @@ func TestWatcher_isWatchedFile(t *testing.T) {
 			w := Watcher{
 				includedExtensions: tt.includedExtensions,
 				includedPatterns:   tt.includedPatterns,
+				trackModules:       tt.trackModules,
+			}
+			wp := w.defaultPath("/app")
+			if got := wp.filter(filepath.Join("/app", tt.path)) == ""; got != tt.want {
+				t.Errorf("filter(%q) watched = %v, want %v", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsIgnoredFolder(t *testing.T) {
+	tests := []struct {
+		name           string
+		ignoredFolders []string
+		path           string
+		want           bool
+	}{
+		{
+			name: "file in app root",
+			path: "/app/main.go",
+			want: false,
+		},
+		{
+			name:           "file in ignored folder",
+			ignoredFolders: []string{"vendor"},
+			path:           "/app/vendor/lib/lib.go",
+			want:           true,
+		},
+		{
+			name: "git dir is always ignored",
+			path: "/app/.git/index.lock",
+			want: true,
+		},
+		{
+			name: "git dir of a nested repository is ignored",
+			path: "/app/modules/lib/.git/HEAD",
+			want: true,
+		},
+		{
+			name: "file with git in the name",
+			path: "/app/.gitignore",
+			want: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isIgnoredFolder(tt.ignoredFolders, "/app", tt.path); got != tt.want {
+				t.Errorf("isIgnoredFolder(%q) = %v, want %v", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsWithin(t *testing.T) {
+	tests := []struct {
+		name string
+		path string
+		want bool
+	}{
+		{name: "same dir", path: "/app", want: true},
+		{name: "nested dir", path: "/app/lib", want: true},
+		{name: "parent dir", path: "/", want: false},
+		{name: "sibling dir", path: "/lib", want: false},
+		{name: "nested dir starting with dots", path: "/app/..lib", want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isWithin("/app", tt.path); got != tt.want {
+				t.Errorf("isWithin(%q) = %v, want %v", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWatcher_resolveRoot(t *testing.T) {
+	appPath := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(appPath, "templates"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(appPath, ".env"), "")
+
+	tests := []struct {
+		name       string
+		root       WatchRoot
+		wantDir    string
+		wantFile   string
+		wantErr    bool
+		wantAll    bool
+		wantAction string
+	}{
+		{
+			name:       "relative directory with default action",
+			root:       WatchRoot{Path: "templates", IncludedExtensions: []string{".html"}},
+			wantDir:    filepath.Join(appPath, "templates"),
+			wantAction: ActionBuild,
+		},
+		{
+			name:       "directory without filters matches all files",
+			root:       WatchRoot{Path: "./templates/", Action: ActionReload},
+			wantDir:    filepath.Join(appPath, "templates"),
+			wantAll:    true,
+			wantAction: ActionReload,
+		},
+		{
+			name:       "single file is watched via its directory",
+			root:       WatchRoot{Path: ".env", Action: ActionRestart},
+			wantDir:    appPath,
+			wantFile:   ".env",
+			wantAll:    true,
+			wantAction: ActionRestart,
+		},
+		{
+			name:    "invalid action",
+			root:    WatchRoot{Path: "templates", Action: "deploy"},
+			wantErr: true,
+		},
+		{
+			name:    "missing path",
+			root:    WatchRoot{Path: "missing"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := &Watcher{appPath: appPath}
+			wp, err := w.resolveRoot(tt.root)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if wp.dir != tt.wantDir || wp.file != tt.wantFile || wp.matchAll != tt.wantAll || wp.Action != tt.wantAction {
+				t.Errorf("resolveRoot() = dir %q, file %q, matchAll %v, action %q", wp.dir, wp.file, wp.matchAll, wp.Action)
+			}
+		})
+	}
+}
+
+func TestWatchedPath_filter(t *testing.T) {
+	templates := watchedPath{
+		WatchRoot: WatchRoot{Path: "templates", Recursive: true, IncludedExtensions: []string{".html"}, Action: ActionReload},
+		dir:       "/app/templates",
+	}
+	env := watchedPath{
+		WatchRoot: WatchRoot{Path: ".env", Action: ActionRestart},
+		dir:       "/app",
+		file:      ".env",
+		matchAll:  true,
+	}
+	app := watchedPath{
+		WatchRoot: WatchRoot{Path: "/app", Recursive: true, IncludedExtensions: []string{".go", ".html"}},
+		dir:       "/app",
+		excluded:  []watchedPath{templates, env},
+	}
+	appModules := app
+	appModules.modules = true
+
+	tests := []struct {
+		name   string
+		wp     watchedPath
+		path   string
+		wantOK bool
+	}{
+		{name: "go file in app root", wp: app, path: "/app/main.go", wantOK: true},
+		{name: "go.mod in app root", wp: app, path: "/app/go.mod", wantOK: false},
+		{name: "go.mod in app root when tracking modules", wp: appModules, path: "/app/go.mod", wantOK: true},
+		{name: "not included file in app root", wp: app, path: "/app/README.md", wantOK: false},
+		{name: "file of nested root is not built", wp: app, path: "/app/templates/index.html", wantOK: false},
+		{name: "file of nested single file root is not built", wp: app, path: "/app/.env", wantOK: false},
+		{name: "file in nested root not matched by its filters is built", wp: app, path: "/app/templates/helpers.go", wantOK: true},
+		{name: "html file in other dir is built", wp: app, path: "/app/web/index.html", wantOK: true},
+		{name: "file of root", wp: templates, path: "/app/templates/layout/base.html", wantOK: true},
+		{name: "go.mod is not matched by root with filters", wp: templates, path: "/app/templates/go.mod", wantOK: false},
+		{name: "single file root", wp: env, path: "/app/.env", wantOK: true},
+		{name: "other file in directory of single file root", wp: env, path: "/app/.env.local", wantOK: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reason := tt.wp.filter(tt.path)
+			if (reason == "") != tt.wantOK {
+				t.Errorf("filter(%q) = %q, want watched %v", tt.path, reason, tt.wantOK)
 			}
-			if got := w.isWatchedFile(tt.path); got != tt.want {
-				t.Errorf("isWatchedFile(%q) = %v, want %v", tt.path, got, tt.want)
+		})
+	}
+}
+
+func TestEventMask(t *testing.T) {
+	tests := []struct {
+		name    string
+		ignored []string
+		attrib  bool
+		want    notify.Event
+		wantErr bool
+	}{
+		{
+			name: "all events by default",
+			want: notify.All,
+		},
+		{
+			name:   "all events and attribute changes",
+			attrib: true,
+			want:   notify.All | attribEvent,
+		},
+		{
+			name:    "ignore chmod",
+			ignored: []string{"chmod"},
+			attrib:  true,
+			want:    notify.All,
+		},
+		{
+			name:    "ignore chmod without watching attribute changes",
+			ignored: []string{"chmod"},
+			want:    notify.All,
+		},
+		{
+			name:    "ignore attrib and remove with whitespace and case",
+			ignored: []string{" Attrib ", "REMOVE"},
+			attrib:  true,
+			want:    notify.Create | notify.Write | notify.Rename,
+		},
+		{
+			name:    "unknown event type",
+			ignored: []string{"touch"},
+			wantErr: true,
+		},
+		{
+			name:    "all event types ignored",
+			ignored: []string{"create", "remove", "write", "rename", "chmod"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := eventMask(tt.ignored, tt.attrib)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("eventMask(%v) = %v, want error", tt.ignored, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("eventMask(%v) = %v, want %v", tt.ignored, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAssetType(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{path: "/app/static/main.css", want: AssetCSS},
+		{path: "/app/static/Logo.PNG", want: AssetImage},
+		{path: "/app/static/icon.svg", want: AssetImage},
+		{path: "/app/static/main.css.map", want: ""},
+		{path: "/app/static/app.js", want: ""},
+		{path: "/app/main.go", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if got := assetType(tt.path); got != tt.want {
+				t.Errorf("assetType(%q) = %q, want %q", tt.path, got, tt.want)
 			}
 		})
 	}
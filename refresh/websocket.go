@@ -0,0 +1,190 @@
+package refresh
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/apex/log"
+	"golang.org/x/net/websocket"
+)
+
+// wsWriteTimeout is the maximum time for sending a message to a WebSocket client before it is dropped
+const wsWriteTimeout = 5 * time.Second
+
+// wsMessage is an event sent to WebSocket clients, it carries the same event name and data as the SSE stream
+type wsMessage struct {
+	ID    string `json:"id"`
+	Event string `json:"event"`
+	Data  string `json:"data"`
+}
+
+// wsClientMessage is the state a WebSocket client sends after connecting and on every change
+type wsClientMessage struct {
+	Type    string `json:"type"`
+	URL     string `json:"url"`
+	Visible *bool  `json:"visible"`
+}
+
+type wsClient struct {
+	conn *websocket.Conn
+
+	mu      sync.Mutex
+	url     string
+	visible bool
+	// pending are the events from a restart on that are sent when the page becomes visible again,
+	// later events are deferred as well to keep the order of event IDs
+	pending []wsMessage
+}
+
+// wsHub sends live reload events to WebSocket clients. Restart events for hidden pages are deferred
+// until the page becomes visible, so background tabs don't reload all at once.
+type wsHub struct {
+	mu      sync.Mutex
+	clients map[*wsClient]struct{}
+	replay  *replayBuffer
+	// allowOrigin checks if a page of the origin may receive events, like the CORS check of SSE
+	allowOrigin func(origin string) bool
+}
+
+func newWSHub(replay *replayBuffer, allowOrigin func(origin string) bool) *wsHub {
+	return &wsHub{
+		clients:     make(map[*wsClient]struct{}),
+		replay:      replay,
+		allowOrigin: allowOrigin,
+	}
+}
+
+func (h *wsHub) handler() http.Handler {
+	return websocket.Server{
+		// Pages of the app are served from another origin, only the allowed origins are accepted
+		Handshake: func(_ *websocket.Config, r *http.Request) error {
+			if origin := r.Header.Get("Origin"); origin != "" && !h.allowOrigin(origin) {
+				return fmt.Errorf("origin %s not allowed", origin)
+			}
+			return nil
+		},
+		Handler: h.serve,
+	}
+}
+
+func (h *wsHub) serve(conn *websocket.Conn) {
+	c := &wsClient{
+		conn:    conn,
+		visible: true,
+	}
+
+	// Replay the events a reconnecting client missed. The client is registered while the replayed events are
+	// looked up, so every later event is broadcast to it. Broadcasts wait until the replay is sent to keep the order.
+	c.mu.Lock()
+	h.mu.Lock()
+	h.clients[c] = struct{}{}
+	missed := h.replay.replay(lastEventID(conn.Request()))
+	h.mu.Unlock()
+	for _, e := range missed {
+		h.sendLocked(c, wsMessage{
+			ID:    e.id,
+			Event: e.event,
+			Data:  string(e.data),
+		})
+	}
+	c.mu.Unlock()
+
+	defer func() {
+		h.mu.Lock()
+		delete(h.clients, c)
+		h.mu.Unlock()
+		conn.Close()
+	}()
+
+	for {
+		var msg wsClientMessage
+		err := websocket.JSON.Receive(conn, &msg)
+		if err != nil {
+			return
+		}
+		if msg.Type != "state" {
+			continue
+		}
+
+		c.mu.Lock()
+		if msg.URL != "" {
+			c.url = msg.URL
+		}
+		if msg.Visible != nil {
+			c.visible = *msg.Visible
+		}
+		log.
+			WithField("url", c.url).
+			WithField("visible", c.visible).
+			Debug("liveReload: WebSocket client state")
+
+		// Deferred events are sent before the lock is released, so new events are sent after them
+		if c.visible {
+			for _, msg := range c.pending {
+				h.sendLocked(c, msg)
+			}
+			c.pending = nil
+		}
+		c.mu.Unlock()
+	}
+}
+
+func (h *wsHub) broadcast(id, event string, data []byte) {
+	msg := wsMessage{
+		ID:    id,
+		Event: event,
+		Data:  string(data),
+	}
+
+	h.mu.Lock()
+	clients := make([]*wsClient, 0, len(h.clients))
+	for c := range h.clients {
+		clients = append(clients, c)
+	}
+	h.mu.Unlock()
+
+	for _, c := range clients {
+		c.mu.Lock()
+		switch {
+		case c.visible:
+			h.sendLocked(c, msg)
+		case event == refreshRestartEventName:
+			// The page is reloaded on a restart, so events before it are not needed anymore
+			c.pending = []wsMessage{msg}
+		case len(c.pending) > 0:
+			c.pending = append(c.pending, msg)
+		default:
+			h.sendLocked(c, msg)
+		}
+		c.mu.Unlock()
+	}
+}
+
+func (h *wsHub) sendLocked(c *wsClient, msg wsMessage) {
+	_ = c.conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+	err := websocket.JSON.Send(c.conn, msg)
+	if err != nil {
+		log.WithError(err).Debug("liveReload: Dropping WebSocket client")
+		c.conn.Close()
+	}
+}
+
+// close disconnects all clients, hijacked connections are not closed by shutting down the HTTP server
+func (h *wsHub) close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for c := range h.clients {
+		c.conn.Close()
+	}
+}
+
+// wsURL converts an HTTP URL of the live reload server to a WebSocket URL
+func wsURL(url string) string {
+	if strings.HasPrefix(url, "https://") {
+		return "wss://" + strings.TrimPrefix(url, "https://")
+	}
+	return "ws://" + strings.TrimPrefix(url, "http://")
+}
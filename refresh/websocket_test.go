@@ -0,0 +1,172 @@
+package refresh
+
+import (
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+func TestWSHub_deferHiddenRestart(t *testing.T) {
+	replay := newReplayBuffer(replayBufferSize)
+	h := newWSHub(replay, allowedOrigins(&Configuration{}))
+	srv := httptest.NewServer(h.handler())
+	defer srv.Close()
+	defer h.close()
+
+	conn, err := websocket.Dial(wsURL(srv.URL), "", srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	hidden, visible := false, true
+	sendState(t, conn, wsClientMessage{Type: "state", URL: "http://localhost/", Visible: &hidden})
+	waitFor(t, func() bool {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		for c := range h.clients {
+			c.mu.Lock()
+			defer c.mu.Unlock()
+			return !c.visible
+		}
+		return false
+	})
+
+	publish := func(event string) {
+		id := replay.add(event, []byte(event))
+		h.broadcast(id, event, []byte(event))
+	}
+	publish(refreshAssetEventName)
+	publish(refreshRestartEventName)
+	publish(refreshRestartEventName)
+	publish(refreshBuildFailedEventName)
+
+	// Events before the first restart are sent to hidden pages
+	if msg := receive(t, conn); msg.Event != refreshAssetEventName {
+		t.Fatalf("received %s, want %s", msg.Event, refreshAssetEventName)
+	}
+
+	sendState(t, conn, wsClientMessage{Type: "state", Visible: &visible})
+
+	// Only the last restart and the events after it are sent in order when the page is visible again
+	var ids []string
+	for _, want := range []string{refreshRestartEventName, refreshBuildFailedEventName} {
+		msg := receive(t, conn)
+		if msg.Event != want {
+			t.Fatalf("received %s, want %s", msg.Event, want)
+		}
+		ids = append(ids, msg.ID)
+	}
+	if ids[0] >= ids[1] {
+		t.Errorf("events received out of order: %v", ids)
+	}
+}
+
+func TestWSHub_origin(t *testing.T) {
+	h := newWSHub(newReplayBuffer(replayBufferSize), allowedOrigins(&Configuration{}))
+	srv := httptest.NewServer(h.handler())
+	defer srv.Close()
+	defer h.close()
+
+	tests := []struct {
+		origin  string
+		wantErr bool
+	}{
+		{origin: "http://localhost:3000"},
+		{origin: "https://example.com", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.origin, func(t *testing.T) {
+			conn, err := websocket.Dial(wsURL(srv.URL), "", tt.origin)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Dial() error = %v, want error %v", err, tt.wantErr)
+			}
+			if conn != nil {
+				conn.Close()
+			}
+		})
+	}
+}
+
+func TestWSHub_replayOrder(t *testing.T) {
+	replay := newReplayBuffer(replayBufferSize)
+	h := newWSHub(replay, allowedOrigins(&Configuration{}))
+	srv := httptest.NewServer(h.handler())
+	defer srv.Close()
+	defer h.close()
+
+	publish := func() string {
+		id := replay.add(refreshAssetEventName, nil)
+		h.broadcast(id, refreshAssetEventName, nil)
+		return id
+	}
+	lastID := publish()
+	publish()
+
+	// Events published while the client connects are either replayed or broadcast, but never out of order
+	const concurrent = 50
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < concurrent; i++ {
+			publish()
+		}
+	}()
+
+	conn, err := websocket.Dial(wsURL(srv.URL)+"?lastEventId="+lastID, "", srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	<-done
+
+	var last uint64 = 1
+	for last < concurrent+2 {
+		msg := receive(t, conn)
+		_, seqStr, _ := strings.Cut(msg.ID, "-")
+		seq, err := strconv.ParseUint(seqStr, 10, 64)
+		if err != nil {
+			t.Fatal(err)
+		}
+		switch {
+		case seq < last:
+			t.Fatalf("received event %d after %d", seq, last)
+		case seq > last+1:
+			t.Fatalf("missed events between %d and %d", last, seq)
+		}
+		last = seq
+	}
+}
+
+func sendState(t *testing.T, conn *websocket.Conn, msg wsClientMessage) {
+	t.Helper()
+	if err := websocket.JSON.Send(conn, msg); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func receive(t *testing.T, conn *websocket.Conn) wsMessage {
+	t.Helper()
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var msg wsMessage
+	if err := websocket.JSON.Receive(conn, &msg); err != nil {
+		t.Fatal(err)
+	}
+	return msg
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for condition")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
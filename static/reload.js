@@ -1,26 +1,412 @@
-function connectSSE() {
-    const eventSource = new EventSource('${REFRESH_LIVE_RELOAD_SSE_URL}');
+// The script runs in the scope of the app page, so nothing is added to the global scope
+(function () {
+    'use strict';
 
-    eventSource.addEventListener('refresh-restart', function (event) {
-        window.location.reload();
-    });
+    const overlayId = 'refresh-overlay';
+
+    function removeOverlay() {
+        const overlay = document.getElementById(overlayId);
+        if (overlay) {
+            overlay.remove();
+        }
+    }
+
+    // Render a dismissible overlay with a title and a list of entries (text and an optional link)
+    function showOverlay(title, entries, output) {
+        removeOverlay();
+
+        const overlay = document.createElement('div');
+        overlay.id = overlayId;
+        overlay.style.cssText = 'position:fixed;inset:0;z-index:2147483647;overflow:auto;padding:32px;' +
+            'background:rgba(24,24,27,0.92);color:#fafafa;font:14px/1.5 ui-monospace,SFMono-Regular,Menlo,monospace;';
+
+        const close = document.createElement('button');
+        close.textContent = '×';
+        close.title = 'Dismiss';
+        close.style.cssText = 'position:absolute;top:16px;right:24px;background:none;border:none;color:inherit;' +
+            'font-size:28px;cursor:pointer;';
+        close.onclick = removeOverlay;
+        overlay.appendChild(close);
+
+        const heading = document.createElement('h2');
+        heading.textContent = title;
+        heading.style.cssText = 'margin:0 0 16px;color:#f87171;font-size:18px;';
+        overlay.appendChild(heading);
+
+        const list = document.createElement('ul');
+        list.style.cssText = 'list-style:none;margin:0;padding:0;';
+        entries.forEach(function (entry) {
+            const item = document.createElement('li');
+            item.style.cssText = 'margin-bottom:8px;';
+            if (entry.location) {
+                const link = document.createElement(entry.url ? 'a' : 'span');
+                if (entry.url) {
+                    link.href = entry.url;
+                }
+                link.textContent = entry.location;
+                link.style.cssText = 'color:#93c5fd;margin-right:8px;';
+                item.appendChild(link);
+            }
+            item.appendChild(document.createTextNode(entry.message));
+            list.appendChild(item);
+        });
+        overlay.appendChild(list);
+
+        if (output) {
+            const pre = document.createElement('pre');
+            pre.textContent = output;
+            pre.style.cssText = 'margin:16px 0 0;white-space:pre-wrap;color:#d4d4d8;';
+            overlay.appendChild(pre);
+        }
+
+        document.body.appendChild(overlay);
+    }
+
+    // Find elements with a URL that ends with the changed path, dropping leading directories of the path until there is a match
+    function matchingElements(elements, attr, path) {
+        const segments = path.split('/');
+        while (segments.length > 0) {
+            const suffix = '/' + segments.join('/');
+            const matches = elements.filter(function (el) {
+                const value = el.getAttribute(attr);
+                if (!value) {
+                    return false;
+                }
+                const url = new URL(value, window.location.href);
+                return url.pathname.endsWith(suffix);
+            });
+            if (matches.length > 0) {
+                return matches;
+            }
+            segments.shift();
+        }
+        return [];
+    }
+
+    function cacheBusted(value) {
+        const url = new URL(value, window.location.href);
+        url.searchParams.set('refresh', Date.now().toString());
+        return url.toString();
+    }
+
+    // Swap a changed stylesheet or image without reloading the page
+    function swapAsset(payload) {
+        if (payload.type === 'css') {
+            const links = Array.from(document.querySelectorAll('link[rel="stylesheet"][href]'));
+            let matches = matchingElements(links, 'href', payload.path);
+            // The file might be imported by another stylesheet, so all stylesheets are refreshed
+            if (matches.length === 0) {
+                matches = links;
+            }
+            matches.forEach(function (link) {
+                // Replace the link after the new stylesheet is loaded to prevent a flash of unstyled content
+                const next = link.cloneNode();
+                next.href = cacheBusted(link.getAttribute('href'));
+                next.onload = function () {
+                    link.remove();
+                };
+                next.onerror = next.onload;
+                link.after(next);
+            });
+            return;
+        }
+
+        if (payload.type === 'image') {
+            const images = Array.from(document.querySelectorAll('img[src]'));
+            const matches = matchingElements(images, 'src', payload.path);
+            if (matches.length === 0) {
+                // Images might be referenced in other ways (e.g. in CSS), so fall back to a reload
+                window.location.reload();
+                return;
+            }
+            matches.forEach(function (img) {
+                img.src = cacheBusted(img.getAttribute('src'));
+            });
+        }
+    }
 
-    // Handle any errors that occur
-    eventSource.onerror = function (error) {
-        console.warn('refresh: EventSource failed:', error);
-        eventSource.close(); // Close the current connection
+    const restartKey = 'refresh-restart';
 
-        // Attempt to reconnect after a short delay
+    // Show a small toast with the build that caused the last reload
+    function showRestartToast() {
+        let payload;
+        try {
+            const data = window.sessionStorage.getItem(restartKey);
+            window.sessionStorage.removeItem(restartKey);
+            payload = data && JSON.parse(data);
+        } catch (e) {
+            return;
+        }
+        if (!payload || !payload.version) {
+            return;
+        }
+
+        let text = payload.message;
+        if (payload.buildId) {
+            text = 'Build ' + payload.buildId;
+            if (payload.durationMs) {
+                text += ' in ' + (payload.durationMs / 1000).toFixed(1) + 's';
+            }
+            if (payload.changedFiles.length > 0) {
+                text += ': ' + payload.changedFiles.slice(0, 3).join(', ');
+                if (payload.changedFiles.length > 3) {
+                    text += ' and ' + (payload.changedFiles.length - 3) + ' more';
+                }
+            }
+        }
+
+        const toast = document.createElement('div');
+        toast.textContent = '⚡️ ' + text;
+        toast.style.cssText = 'position:fixed;bottom:16px;right:16px;z-index:2147483647;padding:8px 12px;' +
+            'border-radius:6px;background:rgba(24,24,27,0.9);color:#fafafa;font:13px/1.4 system-ui,sans-serif;' +
+            'transition:opacity 0.3s;pointer-events:none;';
+        document.body.appendChild(toast);
         setTimeout(function () {
-            console.debug('refresh: Attempting to reconnect...');
-            connectSSE(); // Attempt to reconnect
-        }, 5000); // Reconnect after 5 seconds
-    };
+            toast.style.opacity = '0';
+            setTimeout(function () {
+                toast.remove();
+            }, 300);
+        }, 3000);
+    }
+
+    function parsePayload(event) {
+        try {
+            return JSON.parse(event.data);
+        } catch (e) {
+            console.warn('refresh: Invalid event data:', e);
+            return null;
+        }
+    }
+
+    // Handlers of live reload events, they are used for both transports
+    const handlers = {
+        'refresh-restart': function (event) {
+            removeOverlay();
+            // Keep the payload for showing a toast after the reload
+            try {
+                window.sessionStorage.setItem(restartKey, event.data);
+            } catch (e) {
+                // Storage might be disabled
+            }
+            window.location.reload();
+        },
 
-    // Clean up the event source when the page is closed or reloaded
-    window.onbeforeunload = () => {
-        eventSource.close();
+        'refresh-asset': function (event) {
+            const payload = parsePayload(event);
+            if (!payload) {
+                return;
+            }
+            console.debug('refresh: Swapping asset', payload.path);
+            swapAsset(payload);
+        },
+
+        'refresh-build-failed': function (event) {
+            const payload = parsePayload(event);
+            if (!payload) {
+                return;
+            }
+            const entries = payload.diagnostics.map(function (d) {
+                let location = d.file;
+                if (d.line) {
+                    location += ':' + d.line;
+                    if (d.column) {
+                        location += ':' + d.column;
+                    }
+                }
+                return {location: location, url: d.url, message: d.message};
+            });
+            const title = payload.service ? 'Build of ' + payload.service + ' failed' : 'Build failed';
+            showOverlay(title, entries, payload.output);
+        },
+
+        'refresh-crashed': function (event) {
+            const payload = parsePayload(event);
+            if (!payload) {
+                return;
+            }
+            const name = [payload.service, payload.process].filter(Boolean).join('/');
+            const title = name ? 'Process ' + name + ' crashed' : 'The app crashed';
+            showOverlay(title, [{message: payload.error}], payload.output);
+        },
     };
-}
 
-connectSSE();
+    const sseURL = '${REFRESH_LIVE_RELOAD_SSE_URL}';
+    const wsURL = '${REFRESH_LIVE_RELOAD_WS_URL}';
+    const transportKey = 'refresh-transport';
+
+    // A connection that is closed sooner than this counts as failed (e.g. a proxy that kills long-lived responses)
+    const minConnectionTime = 10000;
+    const maxReconnectDelay = 30000;
+
+    let failures = 0;
+    let current = null;
+
+    // ID of the last received event, it is sent on reconnects to replay missed events
+    let lastEventId = '';
+
+    // Event IDs consist of an instance of the server and a sequence number
+    function parseEventId(id) {
+        const i = id.lastIndexOf('-');
+        return {instance: id.slice(0, i), seq: parseInt(id.slice(i + 1), 10)};
+    }
+
+    // Dispatch an event to its handler, events that were already received (e.g. replayed twice) are skipped
+    function dispatch(name, id, data) {
+        if (id && lastEventId) {
+            const last = parseEventId(lastEventId);
+            const current = parseEventId(id);
+            if (current.instance === last.instance && current.seq <= last.seq) {
+                return;
+            }
+        }
+        if (id) {
+            lastEventId = id;
+        }
+        const handler = handlers[name];
+        if (handler) {
+            handler({data: data});
+        }
+    }
+
+    function withLastEventId(url) {
+        if (!lastEventId) {
+            return url;
+        }
+        const separator = url.indexOf('?') === -1 ? '?' : '&';
+        return url + separator + 'lastEventId=' + encodeURIComponent(lastEventId);
+    }
+
+    // Prefer WebSockets, unless they did not work in this session before
+    function preferredTransport() {
+        if (!('WebSocket' in window)) {
+            return 'sse';
+        }
+        try {
+            return window.sessionStorage.getItem(transportKey) || 'websocket';
+        } catch (e) {
+            // Storage might be disabled
+            return 'websocket';
+        }
+    }
+
+    function otherTransport(transport) {
+        if (transport === 'websocket' || !('WebSocket' in window)) {
+            return 'sse';
+        }
+        return 'websocket';
+    }
+
+    // Reconnect with an exponential backoff, switching to the other transport if the connection keeps failing
+    function reconnect(transport, openedAt) {
+        if (!openedAt || Date.now() - openedAt < minConnectionTime) {
+            failures++;
+        } else {
+            failures = 0;
+        }
+        if (failures >= 2) {
+            const next = otherTransport(transport);
+            if (next !== transport) {
+                console.debug('refresh: Switching to transport', next);
+                try {
+                    window.sessionStorage.setItem(transportKey, next);
+                } catch (e) {
+                    // Storage might be disabled, the transport is only switched for this page
+                }
+                transport = next;
+            }
+        }
+
+        const delay = Math.min(1000 * Math.pow(2, failures), maxReconnectDelay);
+        setTimeout(function () {
+            console.debug('refresh: Attempting to reconnect...');
+            connect(transport);
+        }, delay);
+    }
+
+    function connectSSE() {
+        const eventSource = new EventSource(withLastEventId(sseURL));
+        let openedAt = null;
+
+        eventSource.onopen = function () {
+            openedAt = Date.now();
+        };
+
+        Object.keys(handlers).forEach(function (name) {
+            eventSource.addEventListener(name, function (event) {
+                dispatch(name, event.lastEventId, event.data);
+            });
+        });
+
+        // Handle any errors that occur
+        eventSource.onerror = function (error) {
+            console.warn('refresh: EventSource failed:', error);
+            eventSource.close(); // Close the current connection
+            reconnect('sse', openedAt);
+        };
+
+        return eventSource;
+    }
+
+    function connectWebSocket() {
+        const socket = new WebSocket(withLastEventId(wsURL));
+        let openedAt = null;
+
+        // Send the page state, so the server can defer reloads of hidden pages
+        const sendState = function () {
+            if (socket.readyState !== WebSocket.OPEN) {
+                return;
+            }
+            socket.send(JSON.stringify({
+                type: 'state',
+                url: window.location.href,
+                visible: document.visibilityState === 'visible',
+            }));
+        };
+
+        socket.onopen = function () {
+            openedAt = Date.now();
+            sendState();
+        };
+        document.addEventListener('visibilitychange', sendState);
+
+        socket.onmessage = function (message) {
+            let msg;
+            try {
+                msg = JSON.parse(message.data);
+            } catch (e) {
+                console.warn('refresh: Invalid message:', e);
+                return;
+            }
+            dispatch(msg.event, msg.id, msg.data);
+        };
+
+        socket.onclose = function () {
+            console.warn('refresh: WebSocket closed');
+            document.removeEventListener('visibilitychange', sendState);
+            reconnect('websocket', openedAt);
+        };
+
+        return socket;
+    }
+
+    function connect(transport) {
+        current = transport === 'websocket' ? connectWebSocket() : connectSSE();
+    }
+
+    // Clean up the connection when the page is closed or reloaded
+    window.addEventListener('beforeunload', function () {
+        if (current) {
+            current.onerror = null;
+            current.onclose = null;
+            current.close();
+        }
+    });
+
+    if (document.readyState === 'loading') {
+        document.addEventListener('DOMContentLoaded', showRestartToast);
+    } else {
+        showRestartToast();
+    }
+
+    connect(preferredTransport());
+})();